@@ -0,0 +1,116 @@
+/*
+Copyright 2021 Josh Deprez
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Command atlaspack packs PNG images into a texture atlas, for use with
+// engine.Sheet.Atlas. Usage:
+//
+//	atlaspack [-o atlas] [-cell WxH] [-padding N] [-max N] [-notrim] FILE.png...
+//
+// Each input file becomes a frame named after the file (without extension).
+// With -cell, each input is instead split into a grid of cells, named after
+// the file followed by "/" and the cell index (e.g. "aw/0", "aw/1", ...), so
+// that existing grid sheets can be moved into an atlas as-is. The atlas is
+// written to OUT.png and OUT.json.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"image"
+	"image/png"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/DrJosh9000/ichigo/engine"
+)
+
+var (
+	outBase = flag.String("o", "atlas", "output path, without extension")
+	cell    = flag.String("cell", "", "split inputs into cells of this size (WxH)")
+	padding = flag.Int("padding", 0, "transparent pixels between frames")
+	maxSize = flag.Int("max", engine.DefaultAtlasMaxSize, "maximum atlas width and height")
+	noTrim  = flag.Bool("notrim", false, "don't trim transparent borders")
+)
+
+func main() {
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var cellSize image.Point
+	if *cell != "" {
+		if _, err := fmt.Sscanf(*cell, "%dx%d", &cellSize.X, &cellSize.Y); err != nil || cellSize.X <= 0 || cellSize.Y <= 0 {
+			log.Fatalf("Invalid -cell %q: want WxH", *cell)
+		}
+	}
+
+	var sprites []engine.AtlasSprite
+	for _, p := range flag.Args() {
+		img, err := readPNG(p)
+		if err != nil {
+			log.Fatalf("Couldn't read input: %v", err)
+		}
+		name := strings.TrimSuffix(filepath.Base(p), filepath.Ext(p))
+		if cellSize == (image.Point{}) {
+			sprites = append(sprites, engine.AtlasSprite{Name: name, Image: img})
+			continue
+		}
+		sprites = append(sprites, engine.GridSprites(name+"/", img, cellSize)...)
+	}
+
+	img, atlas, err := engine.PackAtlas(sprites, engine.AtlasOptions{
+		MaxSize: *maxSize,
+		Padding: *padding,
+		NoTrim:  *noTrim,
+	})
+	if err != nil {
+		log.Fatalf("Couldn't pack atlas: %v", err)
+	}
+	atlas.Image = filepath.Base(*outBase) + ".png"
+
+	f, err := os.Create(*outBase + ".png")
+	if err != nil {
+		log.Fatalf("Couldn't create image: %v", err)
+	}
+	if err := png.Encode(f, img); err != nil {
+		log.Fatalf("Couldn't encode image: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		log.Fatalf("Couldn't close image: %v", err)
+	}
+	data, err := json.MarshalIndent(atlas, "", "\t")
+	if err != nil {
+		log.Fatalf("Couldn't marshal atlas: %v", err)
+	}
+	if err := os.WriteFile(*outBase+".json", data, 0o644); err != nil {
+		log.Fatalf("Couldn't write atlas: %v", err)
+	}
+	log.Printf("Packed %d frames into %v", len(sprites), img.Bounds().Size())
+}
+
+func readPNG(p string) (image.Image, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return png.Decode(f)
+}
@@ -17,9 +17,9 @@ limitations under the License.
 package engine
 
 import (
-	"encoding/gob"
 	"errors"
-	"log"
+	"fmt"
+	"io/fs"
 
 	"github.com/DrJosh9000/ichigo/geom"
 )
@@ -28,12 +28,13 @@ import (
 var _ interface {
 	BoundingBoxer
 	Prepper
+	Validator
 } = &Actor{}
 
 var errCollision = errors.New("collision detected")
 
 func init() {
-	gob.Register(&Actor{})
+	RegisterType(&Actor{})
 }
 
 // Thorson-style movement:
@@ -41,7 +42,7 @@ func init() {
 
 // Actor handles basic movement.
 type Actor struct {
-	CollisionDomain string    // id of component to look for colliders inside of
+	CollisionDomain string    // id or path of component to look for colliders inside of
 	Pos             geom.Int3 // in voxels; multiply by game.VoxelScale for regular Euclidean space
 	Bounds          geom.Box  // in voxels; relative to Pos
 
@@ -58,13 +59,13 @@ func (a *Actor) BoundingBox() geom.Box {
 // given position (not necessarily a.Pos).
 func (a *Actor) CollidesAt(p geom.Int3) bool {
 	bounds := a.Bounds.Add(p)
-	cd := a.game.Component(a.CollisionDomain)
+	cd := a.game.LookupFrom(a, a.CollisionDomain)
 	if cd == nil {
-		log.Printf("collision domain %q not found", a.CollisionDomain)
+		a.game.Log(LevelWarn, "collision domain not found", F("domain", a.CollisionDomain))
 		return false
 	}
-	return errCollision == a.game.Query(cd, ColliderType, nil, func(c any) error {
-		if cl, ok := c.(Collider); ok && cl.CollidesWith(bounds) {
+	return errCollision == QueryEach(a.game, cd, 0, func(c Collider) error {
+		if c.CollidesWith(bounds) {
 			return errCollision
 		}
 		return nil
@@ -152,4 +153,15 @@ func (a *Actor) Prepare(g *Game) error {
 	return nil
 }
 
+// Validate checks that the collision domain (if any) exists.
+func (a *Actor) Validate(g *Game, _ fs.FS) error {
+	if a.CollisionDomain == "" {
+		return nil
+	}
+	if g.LookupFrom(a, a.CollisionDomain) == nil {
+		return fmt.Errorf("collision domain %q not found", a.CollisionDomain)
+	}
+	return nil
+}
+
 func (a *Actor) String() string { return "Actor@" + a.Pos.String() }
@@ -16,7 +16,7 @@ limitations under the License.
 
 package engine
 
-import "encoding/gob"
+import "time"
 
 // Ensure Anim satisfies Animer.
 var _ interface {
@@ -26,7 +26,7 @@ var _ interface {
 } = &Anim{}
 
 func init() {
-	gob.Register(&Anim{})
+	RegisterType(&Anim{})
 }
 
 // AnimDef defines an animation, as a sequence of steps and other information.
@@ -45,8 +45,9 @@ func (d *AnimDef) NewAnim() *Anim {
 
 // AnimStep describes a step in an animation.
 type AnimStep struct {
-	Cell     int // show this cell
-	Duration int // for this long, in ticks
+	Cell     int           // show this cell
+	Duration int           // for this long, in ticks
+	Time     time.Duration // if set, Duration is worked out from this by Sheet.Prepare
 }
 
 // Anim is the current state of an animation being played (think of it as an
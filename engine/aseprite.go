@@ -0,0 +1,321 @@
+/*
+Copyright 2021 Josh Deprez
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Ensure AsepriteRef satisfies interfaces.
+var _ interface {
+	Loader
+	Validator
+} = &AsepriteRef{}
+
+func init() {
+	RegisterType(&AsepriteRef{})
+}
+
+// AsepriteRef loads sprite sheet metadata exported from Aseprite
+// (https://www.aseprite.org) as JSON (File > Export Sprite Sheet, with "JSON
+// Data" checked). Either the "Hash" or "Array" format can be used. The sheet
+// must be exported as a grid: every frame must be the same size, with no
+// borders, padding, or trimming (e.g. sheet type "By Rows" or "Horizontal
+// Strip").
+//
+// Usually an AsepriteRef is used via Sheet.Aseprite, which fills in the Sheet
+// when it is loaded. Only the path is encoded.
+type AsepriteRef struct {
+	Path string
+
+	cellSize image.Point
+	image    string // path to the image, relative to the asset FS
+	animDefs map[string]*AnimDef
+	slices   map[string][]AsepriteSliceKey
+}
+
+// AsepriteSliceKey is the shape of a slice from a certain frame onwards.
+// Aseprite slices are useful for marking hitboxes, attachment points, and so
+// on.
+type AsepriteSliceKey struct {
+	Frame  int             // first frame this key applies to
+	Bounds image.Rectangle // within the frame
+	Center image.Rectangle // for 9-slices; empty if not set
+	Pivot  image.Point     // zero if not set
+}
+
+// Load reads and converts the JSON file. Each frame tag becomes an AnimDef,
+// with the same name, according to the tag's direction (forward, reverse,
+// ping-pong, or ping-pong reverse). Frame durations are kept as each step's
+// Time, and converted to steps when the Sheet is prepared. Tags with a repeat
+// count become one-shot animations that play that many times.
+func (r *AsepriteRef) Load(assets fs.FS) error {
+	data, err := fs.ReadFile(assets, r.Path)
+	if err != nil {
+		return err
+	}
+	if err := r.parse(data); err != nil {
+		return fmt.Errorf("%s: %w", r.Path, err)
+	}
+	if r.image != "" {
+		r.image = path.Join(path.Dir(r.Path), r.image)
+	}
+	return nil
+}
+
+// CellSize returns the size of each frame. It is valid after Load.
+func (r *AsepriteRef) CellSize() image.Point { return r.cellSize }
+
+// ImagePath returns the path to the sheet image, as recorded in the JSON. It
+// is valid after Load.
+func (r *AsepriteRef) ImagePath() string { return r.image }
+
+// AnimDefs returns the animations made from frame tags. It is valid after
+// Load.
+func (r *AsepriteRef) AnimDefs() map[string]*AnimDef { return r.animDefs }
+
+// Slice returns the key of the named slice that applies at the given frame
+// (the key with the largest Frame not exceeding frame). It returns false if
+// there is no such slice, or if the slice has no key at or before frame.
+func (r *AsepriteRef) Slice(name string, frame int) (AsepriteSliceKey, bool) {
+	keys := r.slices[name]
+	i := sort.Search(len(keys), func(i int) bool { return keys[i].Frame > frame })
+	if i == 0 {
+		return AsepriteSliceKey{}, false
+	}
+	return keys[i-1], true
+}
+
+// Validate checks that the file at r.Path exists.
+func (r *AsepriteRef) Validate(_ *Game, assets fs.FS) error {
+	if assets == nil {
+		return nil
+	}
+	_, err := fs.Stat(assets, r.Path)
+	return err
+}
+
+// apply copies the loaded data into s. The image path is only used if s.Src
+// doesn't have one already. Frame tags replace any AnimDefs of the same name.
+func (r *AsepriteRef) apply(s *Sheet) {
+	s.CellSize = r.cellSize
+	if s.Src.Path == "" {
+		s.Src.Path = r.image
+	}
+	if len(r.animDefs) == 0 {
+		return
+	}
+	if s.AnimDefs == nil {
+		s.AnimDefs = make(map[string]*AnimDef, len(r.animDefs))
+	}
+	for k, d := range r.animDefs {
+		s.AnimDefs[k] = d
+	}
+}
+
+func (r *AsepriteRef) String() string { return "AsepriteRef{" + r.Path + "}" }
+
+// The parts of the Aseprite JSON format that are used.
+type (
+	asepriteFile struct {
+		Frames json.RawMessage // either an array or an object
+		Meta   struct {
+			Image     string
+			Size      asepriteSize
+			FrameTags []asepriteTag
+			Slices    []struct {
+				Name string
+				Keys []struct {
+					Frame  int
+					Bounds asepriteRect
+					Center *asepriteRect
+					Pivot  *struct{ X, Y int }
+				}
+			}
+		}
+	}
+
+	asepriteFrame struct {
+		Frame    asepriteRect
+		Duration int // milliseconds
+	}
+
+	asepriteTag struct {
+		Name      string
+		From, To  int
+		Direction string
+		Repeat    json.Number // a string in the JSON, absent if unset
+	}
+
+	asepriteRect struct{ X, Y, W, H int }
+	asepriteSize struct{ W, H int }
+)
+
+func (r asepriteRect) rect() image.Rectangle { return image.Rect(r.X, r.Y, r.X+r.W, r.Y+r.H) }
+
+// asepriteFrames decodes the frames, which are an array or an object. The
+// order of keys in the object is the frame order, so a map can't be used.
+func asepriteFrames(raw json.RawMessage) ([]asepriteFrame, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 {
+		return nil, errors.New("no frames")
+	}
+	var frames []asepriteFrame
+	if raw[0] == '[' {
+		err := json.Unmarshal(raw, &frames)
+		return frames, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	if _, err := dec.Token(); err != nil { // {
+		return nil, err
+	}
+	for dec.More() {
+		if _, err := dec.Token(); err != nil { // key
+			return nil, err
+		}
+		var f asepriteFrame
+		if err := dec.Decode(&f); err != nil {
+			return nil, err
+		}
+		frames = append(frames, f)
+	}
+	return frames, nil
+}
+
+func (r *AsepriteRef) parse(data []byte) error {
+	var file asepriteFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return err
+	}
+	frames, err := asepriteFrames(file.Frames)
+	if err != nil {
+		return err
+	}
+	if len(frames) == 0 {
+		return errors.New("no frames")
+	}
+
+	// Work out which cell each frame is.
+	size := image.Pt(frames[0].Frame.W, frames[0].Frame.H)
+	if size.X <= 0 || size.Y <= 0 {
+		return fmt.Errorf("frame 0 has size %v", size)
+	}
+	cols := file.Meta.Size.W / size.X
+	cells := make([]int, len(frames))
+	for i, f := range frames {
+		if f.Frame.W != size.X || f.Frame.H != size.Y {
+			return fmt.Errorf("frame %d has size %dx%d, want %v (all frames must be the same size)", i, f.Frame.W, f.Frame.H, size)
+		}
+		if f.Frame.X%size.X != 0 || f.Frame.Y%size.Y != 0 {
+			return fmt.Errorf("frame %d at (%d,%d) is not aligned to the grid (export without borders or padding)", i, f.Frame.X, f.Frame.Y)
+		}
+		cells[i] = (f.Frame.Y/size.Y)*cols + f.Frame.X/size.X
+	}
+
+	defs := make(map[string]*AnimDef, len(file.Meta.FrameTags))
+	for _, tag := range file.Meta.FrameTags {
+		if tag.From < 0 || tag.To >= len(frames) || tag.From > tag.To {
+			return fmt.Errorf("tag %q has invalid frame range %d-%d", tag.Name, tag.From, tag.To)
+		}
+		order, err := asepriteOrder(tag.From, tag.To, tag.Direction)
+		if err != nil {
+			return fmt.Errorf("tag %q: %w", tag.Name, err)
+		}
+		def := &AnimDef{}
+		repeat := 1
+		if tag.Repeat != "" {
+			n, err := strconv.Atoi(string(tag.Repeat))
+			if err != nil || n < 1 {
+				return fmt.Errorf("tag %q has invalid repeat %q", tag.Name, tag.Repeat)
+			}
+			repeat, def.OneShot = n, true
+		}
+		for j := 0; j < repeat; j++ {
+			for _, i := range order {
+				def.Steps = append(def.Steps, AnimStep{
+					Cell: cells[i],
+					Time: time.Duration(frames[i].Duration) * time.Millisecond,
+				})
+			}
+		}
+		defs[tag.Name] = def
+	}
+
+	slices := make(map[string][]AsepriteSliceKey, len(file.Meta.Slices))
+	for _, s := range file.Meta.Slices {
+		keys := make([]AsepriteSliceKey, 0, len(s.Keys))
+		for _, k := range s.Keys {
+			key := AsepriteSliceKey{
+				Frame:  k.Frame,
+				Bounds: k.Bounds.rect(),
+			}
+			if k.Center != nil {
+				key.Center = k.Center.rect()
+			}
+			if k.Pivot != nil {
+				key.Pivot = image.Pt(k.Pivot.X, k.Pivot.Y)
+			}
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool { return keys[i].Frame < keys[j].Frame })
+		slices[s.Name] = keys
+	}
+
+	r.cellSize = size
+	r.image = file.Meta.Image
+	r.animDefs = defs
+	r.slices = slices
+	return nil
+}
+
+// asepriteOrder returns the frame indexes for one pass through a tag.
+func asepriteOrder(from, to int, direction string) ([]int, error) {
+	var fwd, rev []int
+	for i := from; i <= to; i++ {
+		fwd = append(fwd, i)
+	}
+	for i := to; i >= from; i-- {
+		rev = append(rev, i)
+	}
+	// Ping-pong doesn't repeat the end frames on the way back.
+	inner := func(s []int) []int {
+		if len(s) < 3 {
+			return nil
+		}
+		return s[1 : len(s)-1]
+	}
+	switch direction {
+	case "", "forward":
+		return fwd, nil
+	case "reverse":
+		return rev, nil
+	case "pingpong":
+		return append(fwd, inner(rev)...), nil
+	case "pingpong_reverse":
+		return append(rev, inner(fwd)...), nil
+	}
+	return nil, fmt.Errorf("unknown direction %q", direction)
+}
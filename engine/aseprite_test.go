@@ -0,0 +1,191 @@
+/*
+Copyright 2021 Josh Deprez
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import (
+	"image"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// Frames are deliberately listed out of cell order, to check that the order
+// of keys in the hash is used.
+const testAsepriteJSON = `{
+	"frames": {
+		"aw 0.aseprite": {"frame": {"x": 16, "y": 0, "w": 8, "h": 16}, "duration": 100},
+		"aw 1.aseprite": {"frame": {"x": 0, "y": 0, "w": 8, "h": 16}, "duration": 200},
+		"aw 2.aseprite": {"frame": {"x": 8, "y": 0, "w": 8, "h": 16}, "duration": 100},
+		"aw 3.aseprite": {"frame": {"x": 0, "y": 16, "w": 8, "h": 16}, "duration": 50}
+	},
+	"meta": {
+		"image": "aw.png",
+		"size": {"w": 24, "h": 32},
+		"frameTags": [
+			{"name": "walk", "from": 0, "to": 2, "direction": "forward"},
+			{"name": "back", "from": 1, "to": 2, "direction": "reverse"},
+			{"name": "bob", "from": 0, "to": 3, "direction": "pingpong"},
+			{"name": "blink", "from": 3, "to": 3, "direction": "forward", "repeat": "2"}
+		],
+		"slices": [
+			{"name": "hitbox", "keys": [
+				{"frame": 2, "bounds": {"x": 1, "y": 1, "w": 4, "h": 4}},
+				{"frame": 0, "bounds": {"x": 0, "y": 0, "w": 8, "h": 16}, "pivot": {"x": 4, "y": 15}}
+			]}
+		]
+	}
+}`
+
+func TestSheetLoadAseprite(t *testing.T) {
+	assets := fstest.MapFS{
+		"sprites/aw.json": {Data: []byte(testAsepriteJSON)},
+	}
+	s := &Sheet{
+		AnimDefs: map[string]*AnimDef{
+			"idle": {Steps: []AnimStep{{Cell: 0, Duration: 1}}},
+		},
+		Aseprite: &AsepriteRef{Path: "sprites/aw.json"},
+	}
+	if err := s.Load(assets); err != nil {
+		t.Fatalf("Sheet.Load() = %v", err)
+	}
+	if got, want := s.CellSize, image.Pt(8, 16); got != want {
+		t.Errorf("CellSize = %v, want %v", got, want)
+	}
+	if got, want := s.Src.Path, "sprites/aw.png"; got != want {
+		t.Errorf("Src.Path = %q, want %q", got, want)
+	}
+
+	ms100, ms200, ms50 := 100*time.Millisecond, 200*time.Millisecond, 50*time.Millisecond
+	want := map[string]*AnimDef{
+		"idle": {Steps: []AnimStep{{Cell: 0, Duration: 1}}},
+		"walk": {Steps: []AnimStep{{Cell: 2, Time: ms100}, {Cell: 0, Time: ms200}, {Cell: 1, Time: ms100}}},
+		"back": {Steps: []AnimStep{{Cell: 1, Time: ms100}, {Cell: 0, Time: ms200}}},
+		"bob": {Steps: []AnimStep{
+			{Cell: 2, Time: ms100}, {Cell: 0, Time: ms200}, {Cell: 1, Time: ms100},
+			{Cell: 3, Time: ms50}, {Cell: 1, Time: ms100}, {Cell: 0, Time: ms200},
+		}},
+		"blink": {
+			Steps:   []AnimStep{{Cell: 3, Time: ms50}, {Cell: 3, Time: ms50}},
+			OneShot: true,
+		},
+	}
+	if diff := cmp.Diff(s.AnimDefs, want); diff != "" {
+		t.Errorf("AnimDefs diff (-got +want):\n%s", diff)
+	}
+
+	r := s.Aseprite
+	if _, ok := r.Slice("nope", 0); ok {
+		t.Error("Slice(nope, 0) ok = true, want false")
+	}
+	k, ok := r.Slice("hitbox", 1)
+	if !ok {
+		t.Fatal("Slice(hitbox, 1) ok = false, want true")
+	}
+	if got, want := k, (AsepriteSliceKey{Frame: 0, Bounds: image.Rect(0, 0, 8, 16), Pivot: image.Pt(4, 15)}); got != want {
+		t.Errorf("Slice(hitbox, 1) = %v, want %v", got, want)
+	}
+	if k, _ := r.Slice("hitbox", 3); k.Bounds != image.Rect(1, 1, 5, 5) {
+		t.Errorf("Slice(hitbox, 3).Bounds = %v, want %v", k.Bounds, image.Rect(1, 1, 5, 5))
+	}
+}
+
+func TestAsepriteRefLoadErrors(t *testing.T) {
+	tests := map[string]string{
+		"packed": `{"frames": [
+			{"frame": {"x": 0, "y": 0, "w": 8, "h": 8}, "duration": 100},
+			{"frame": {"x": 9, "y": 0, "w": 8, "h": 8}, "duration": 100}
+		], "meta": {"size": {"w": 17, "h": 8}}}`,
+		"mixed sizes": `{"frames": [
+			{"frame": {"x": 0, "y": 0, "w": 8, "h": 8}, "duration": 100},
+			{"frame": {"x": 8, "y": 0, "w": 4, "h": 8}, "duration": 100}
+		], "meta": {"size": {"w": 16, "h": 8}}}`,
+		"bad tag": `{"frames": [
+			{"frame": {"x": 0, "y": 0, "w": 8, "h": 8}, "duration": 100}
+		], "meta": {"size": {"w": 8, "h": 8}, "frameTags": [{"name": "x", "from": 0, "to": 1}]}}`,
+	}
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := &AsepriteRef{Path: "a.json"}
+			if err := r.Load(fstest.MapFS{"a.json": {Data: []byte(data)}}); err == nil {
+				t.Error("Load() = nil, want error")
+			}
+		})
+	}
+}
+
+func TestSheetPrepareAnimDurations(t *testing.T) {
+	assets := fstest.MapFS{
+		"sprites/aw.json": {Data: []byte(testAsepriteJSON)},
+	}
+	s := &Sheet{Aseprite: &AsepriteRef{Path: "sprites/aw.json"}}
+	if err := s.Load(assets); err != nil {
+		t.Fatalf("Sheet.Load() = %v", err)
+	}
+	// Anims advance once per simulation step, not once per tick.
+	g := &Game{Step: 25 * time.Millisecond}
+	// Prepare doesn't measure the image when Atlas is set.
+	s.Atlas = &AtlasRef{}
+	if err := s.Prepare(g); err != nil {
+		t.Fatalf("Sheet.Prepare() = %v", err)
+	}
+	want := []AnimStep{
+		{Cell: 2, Duration: 4, Time: 100 * time.Millisecond},
+		{Cell: 0, Duration: 8, Time: 200 * time.Millisecond},
+		{Cell: 1, Duration: 4, Time: 100 * time.Millisecond},
+	}
+	if diff := cmp.Diff(s.AnimDefs["walk"].Steps, want); diff != "" {
+		t.Errorf("walk steps diff (-got +want):\n%s", diff)
+	}
+}
+
+func TestTilemapLoadAsepriteAnims(t *testing.T) {
+	assets := fstest.MapFS{
+		"sprites/aw.json": {Data: []byte(testAsepriteJSON)},
+	}
+	at := &AnimatedTile{AnimKey: "walk"}
+	tm := &Tilemap{
+		Map:   map[image.Point]Tile{{}: at},
+		Sheet: Sheet{Aseprite: &AsepriteRef{Path: "sprites/aw.json"}},
+	}
+	// The game loads tm before tm.Sheet.
+	if err := tm.Load(assets); err != nil {
+		t.Fatalf("Tilemap.Load() = %v", err)
+	}
+	if got, want := at.Cell(), 2; got != want {
+		t.Errorf("at.Cell() = %d, want %d", got, want)
+	}
+}
+
+func TestWallLoadAsepriteAnims(t *testing.T) {
+	assets := fstest.MapFS{
+		"sprites/aw.json": {Data: []byte(testAsepriteJSON)},
+	}
+	at := &AnimatedTile{AnimKey: "back"}
+	w := &Wall{
+		Sheet: Sheet{Aseprite: &AsepriteRef{Path: "sprites/aw.json"}},
+		Units: map[image.Point]*WallUnit{{}: {Tile: at}},
+	}
+	if err := w.Load(assets); err != nil {
+		t.Fatalf("Wall.Load() = %v", err)
+	}
+	if got, want := at.Cell(), 1; got != want {
+		t.Errorf("at.Cell() = %d, want %d", got, want)
+	}
+}
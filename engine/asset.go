@@ -17,19 +17,41 @@ limitations under the License.
 package engine
 
 import (
+	"bytes"
 	"compress/gzip"
 	"encoding/gob"
+	"fmt"
+	"io"
 	"io/fs"
-	"os"
-	"path/filepath"
+	"reflect"
 )
 
 type assetKey struct {
-	assets fs.FS
+	assets any // fs.FS, or a pointer for FSes that aren't comparable
 	path   string
 }
 
-// LoadGobz gunzips and gob-decodes a component from a file from a FS.
+// makeAssetKey returns a key for path in assets, usable as a map key even if
+// assets is not comparable (e.g. fstest.MapFS).
+func makeAssetKey(assets fs.FS, path string) assetKey {
+	if assets == nil {
+		return assetKey{nil, path}
+	}
+	v := reflect.ValueOf(assets)
+	if v.Type().Comparable() {
+		return assetKey{assets, path}
+	}
+	switch v.Kind() {
+	case reflect.Map, reflect.Slice, reflect.Func:
+		return assetKey{v.Pointer(), path}
+	}
+	panic(fmt.Sprintf("asset FS type %T is not comparable", assets))
+}
+
+// LoadGobz gunzips and gob-decodes a component from a file from a FS. Files
+// saved with older format versions (see RegisterMigration) are migrated
+// first, and files saved with a newer format version cause a
+// *FormatVersionError.
 func LoadGobz(dst any, assets fs.FS, path string) error {
 	f, err := assets.Open(path)
 	if err != nil {
@@ -40,28 +62,36 @@ func LoadGobz(dst any, assets fs.FS, path string) error {
 	if err != nil {
 		return err
 	}
-	return gob.NewDecoder(gz).Decode(dst)
-}
-
-// SaveGobz takes an object, gob-encodes it, gzips it, and writes to disk.
-// This requires running on something with a disk to write to (not JS)
-func SaveGobz(src any, name string) error {
-	f, err := os.CreateTemp(".", filepath.Base(name))
+	data, err := io.ReadAll(gz)
 	if err != nil {
 		return err
 	}
-	defer os.Remove(f.Name())
-	defer f.Close()
+	payload, err := decodeVersioned(path, data)
+	if err != nil {
+		return err
+	}
+	return gob.NewDecoder(bytes.NewReader(payload)).Decode(dst)
+}
 
-	gz := gzip.NewWriter(f)
-	if err := gob.NewEncoder(gz).Encode(src); err != nil {
+// SaveGobz gob-encodes an object, wraps it with a header recording the format
+// version and engine version, gzips it, and writes it to a file in a WriteFS.
+// The file can be loaded with LoadGobz using the same path.
+func SaveGobz(src any, dst WriteFS, path string) error {
+	var payload bytes.Buffer
+	if err := gob.NewEncoder(&payload).Encode(src); err != nil {
 		return err
 	}
-	if err := gz.Close(); err != nil {
+	data, err := encodeVersioned(payload.Bytes())
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write(data); err != nil {
 		return err
 	}
-	if err := f.Close(); err != nil {
+	if err := gz.Close(); err != nil {
 		return err
 	}
-	return os.Rename(f.Name(), name)
+	return dst.WriteFile(path, buf.Bytes())
 }
@@ -0,0 +1,243 @@
+/*
+Copyright 2021 Josh Deprez
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import (
+	"context"
+	"io/fs"
+	"sync"
+	"time"
+)
+
+// assetSweepInterval is how often Update sweeps the game's asset cache, so
+// that assets used only by components that have since been unregistered
+// (e.g. despawned, or in a popped scene) are freed while the game runs.
+const assetSweepInterval = 10 * time.Second
+
+// AssetCache caches values loaded from asset files (such as images), so that
+// each file is loaded once and shared between all the components using it.
+// Entries are reference-counted: components Acquire an entry while they are
+// registered and Release it when disposed. Sweep removes entries that are no
+// longer referenced, disposing values that are Disposers (such as
+// *ebiten.Image). It is safe to use an AssetCache from multiple goroutines.
+// The zero AssetCache is empty and ready to use.
+type AssetCache struct {
+	mu        sync.Mutex
+	entries   map[assetKey]*cacheEntry
+	forgotten []*cacheEntry // forgotten entries awaiting Sweep
+}
+
+type cacheEntry struct {
+	ready chan struct{} // closed once loading finishes
+	value any
+	size  int64
+	err   error
+	refs  int  // guarded by AssetCache.mu
+	idle  bool // refs is 0 and it may be swept; guarded by AssetCache.mu
+}
+
+// loaded reports whether the entry has finished loading successfully.
+func (e *cacheEntry) loaded() bool {
+	select {
+	case <-e.ready:
+		return e.err == nil
+	default:
+		return false
+	}
+}
+
+// AssetLoadFunc loads an asset value, and returns it along with its
+// approximate size in memory (in bytes).
+type AssetLoadFunc func() (value any, size int64, err error)
+
+// Get returns the value cached for path in assets. If there is no such value,
+// Get calls load to load it. If multiple goroutines Get the same path at the
+// same time, load is only called once, and the other goroutines wait for it.
+// Errors are not cached. Get does not change the reference count.
+func (c *AssetCache) Get(assets fs.FS, path string, load AssetLoadFunc) (any, error) {
+	key := makeAssetKey(assets, path)
+	c.mu.Lock()
+	if c.entries == nil {
+		c.entries = make(map[assetKey]*cacheEntry)
+	}
+	e := c.entries[key]
+	if e != nil {
+		c.mu.Unlock()
+		<-e.ready
+		return e.value, e.err
+	}
+	e = &cacheEntry{ready: make(chan struct{})}
+	c.entries[key] = e
+	c.mu.Unlock()
+
+	e.value, e.size, e.err = load()
+	if e.err != nil {
+		c.mu.Lock()
+		if c.entries[key] == e {
+			delete(c.entries, key)
+		}
+		c.mu.Unlock()
+	}
+	close(e.ready)
+	return e.value, e.err
+}
+
+// Acquire increments the reference count for path in assets. It returns false
+// (and does nothing) if the value is not in the cache.
+func (c *AssetCache) Acquire(assets fs.FS, path string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e := c.entries[makeAssetKey(assets, path)]
+	if e == nil {
+		return false
+	}
+	e.refs++
+	e.idle = false
+	return true
+}
+
+// Release decrements the reference count for path in assets. The value stays
+// in the cache until the next Sweep.
+func (c *AssetCache) Release(assets fs.FS, path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e := c.entries[makeAssetKey(assets, path)]
+	if e == nil || e.refs == 0 {
+		return
+	}
+	e.refs--
+	e.idle = e.refs == 0
+}
+
+// Forget removes the value for path in assets from the cache, regardless of
+// references, so that the next Get for the path loads it afresh. The old value
+// is not disposed straight away, since components may still be using it; it
+// is treated as unreferenced, and disposed by a later Sweep.
+func (c *AssetCache) Forget(assets fs.FS, path string) {
+	key := makeAssetKey(assets, path)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e := c.entries[key]
+	if e == nil || !e.loaded() {
+		return
+	}
+	delete(c.entries, key)
+	e.refs, e.idle = 0, false
+	c.forgotten = append(c.forgotten, e)
+}
+
+// Sweep removes loaded values that have no references from the cache, and
+// disposes those that are Disposers. It returns the number of values removed.
+// Values that have been loaded but never acquired (e.g. by a component that
+// is loaded but not yet registered), or that have been forgotten, survive the
+// first Sweep after that, but not the second.
+func (c *AssetCache) Sweep() int {
+	c.mu.Lock()
+	var unused []any
+	for k, e := range c.entries {
+		if e.refs > 0 || !e.loaded() {
+			continue
+		}
+		if !e.idle {
+			e.idle = true
+			continue
+		}
+		delete(c.entries, k)
+		unused = append(unused, e.value)
+	}
+	kept := c.forgotten[:0]
+	for _, e := range c.forgotten {
+		if !e.idle {
+			e.idle = true
+			kept = append(kept, e)
+			continue
+		}
+		unused = append(unused, e.value)
+	}
+	c.forgotten = kept
+	c.mu.Unlock()
+
+	for _, v := range unused {
+		if d, ok := v.(Disposer); ok {
+			d.Dispose()
+		}
+	}
+	return len(unused)
+}
+
+// AssetCacheStats summarises the contents of an AssetCache.
+type AssetCacheStats struct {
+	Entries     int   // number of loaded values
+	Bytes       int64 // approximate total size of loaded values
+	Unused      int   // number of loaded values with no references
+	UnusedBytes int64 // approximate total size of values with no references
+}
+
+// Stats returns a summary of the values in the cache.
+func (c *AssetCache) Stats() AssetCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var s AssetCacheStats
+	for _, e := range c.entries {
+		if !e.loaded() {
+			continue
+		}
+		s.Entries++
+		s.Bytes += e.size
+		if e.refs == 0 {
+			s.Unused++
+			s.UnusedBytes += e.size
+		}
+	}
+	return s
+}
+
+type assetCacheKey struct{}
+
+// WithAssetCache returns a context carrying an AssetCache, for use by
+// ContextLoaders.
+func WithAssetCache(ctx context.Context, c *AssetCache) context.Context {
+	return context.WithValue(ctx, assetCacheKey{}, c)
+}
+
+// AssetCacheFrom returns the AssetCache carried by ctx, or nil if there is
+// none. Game.LoadContext provides the game's AssetCache this way.
+func AssetCacheFrom(ctx context.Context) *AssetCache {
+	c, _ := ctx.Value(assetCacheKey{}).(*AssetCache)
+	return c
+}
+
+// AssetCache returns the game's asset cache.
+func (g *Game) AssetCache() *AssetCache {
+	g.cacheOnce.Do(func() {
+		g.assetCache = new(AssetCache)
+	})
+	return g.assetCache
+}
+
+// sweepAssets sweeps the asset cache once every assetSweepInterval of real
+// time. It is called from Update.
+func (g *Game) sweepAssets() {
+	g.sinceSweep += tickDuration()
+	if g.sinceSweep < assetSweepInterval {
+		return
+	}
+	g.sinceSweep = 0
+	if n := g.AssetCache().Sweep(); n > 0 {
+		g.Log(LevelDebug, "AssetCache: swept unused assets", F("count", n))
+	}
+}
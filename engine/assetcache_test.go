@@ -0,0 +1,156 @@
+/*
+Copyright 2021 Josh Deprez
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"testing/fstest"
+)
+
+type fakeAsset struct{ disposed bool }
+
+func (a *fakeAsset) Dispose() { a.disposed = true }
+
+func TestAssetCacheGetDedupes(t *testing.T) {
+	var c AssetCache
+	var mu sync.Mutex
+	loads := 0
+	load := func() (any, int64, error) {
+		mu.Lock()
+		loads++
+		mu.Unlock()
+		return &fakeAsset{}, 10, nil
+	}
+	var wg sync.WaitGroup
+	vals := make([]any, 8)
+	for i := range vals {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			v, err := c.Get(nil, "a", load)
+			if err != nil {
+				t.Errorf("Get(a) error = %v", err)
+			}
+			vals[i] = v
+		}(i)
+	}
+	wg.Wait()
+	if loads != 1 {
+		t.Errorf("load called %d times, want 1", loads)
+	}
+	for i, v := range vals {
+		if v != vals[0] {
+			t.Errorf("vals[%d] = %p, want %p", i, v, vals[0])
+		}
+	}
+}
+
+func TestAssetCacheGetErrorNotCached(t *testing.T) {
+	var c AssetCache
+	errBoom := errors.New("boom")
+	if _, err := c.Get(nil, "a", func() (any, int64, error) { return nil, 0, errBoom }); err != errBoom {
+		t.Errorf("Get(a) error = %v, want %v", err, errBoom)
+	}
+	if _, err := c.Get(nil, "a", func() (any, int64, error) { return 1, 0, nil }); err != nil {
+		t.Errorf("Get(a) after error = %v, want nil", err)
+	}
+}
+
+func TestAssetCacheRefsAndSweep(t *testing.T) {
+	var c AssetCache
+	assets := fstest.MapFS{}
+	v, _ := c.Get(assets, "a", func() (any, int64, error) { return &fakeAsset{}, 100, nil })
+	a := v.(*fakeAsset)
+	if !c.Acquire(assets, "a") {
+		t.Fatal("Acquire(a) = false, want true")
+	}
+	if c.Acquire(assets, "missing") {
+		t.Error("Acquire(missing) = true, want false")
+	}
+	if got, want := c.Stats(), (AssetCacheStats{Entries: 1, Bytes: 100}); got != want {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+	if n := c.Sweep(); n != 0 || a.disposed {
+		t.Errorf("Sweep() with a acquired = %d (disposed = %t), want 0 (false)", n, a.disposed)
+	}
+
+	c.Release(assets, "a")
+	if got, want := c.Stats(), (AssetCacheStats{Entries: 1, Bytes: 100, Unused: 1, UnusedBytes: 100}); got != want {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+	if n := c.Sweep(); n != 1 || !a.disposed {
+		t.Errorf("Sweep() after Release = %d (disposed = %t), want 1 (true)", n, a.disposed)
+	}
+
+	// Never-acquired values survive one sweep.
+	v, _ = c.Get(assets, "b", func() (any, int64, error) { return &fakeAsset{}, 1, nil })
+	b := v.(*fakeAsset)
+	if n := c.Sweep(); n != 0 || b.disposed {
+		t.Errorf("first Sweep() of b = %d (disposed = %t), want 0 (false)", n, b.disposed)
+	}
+	if n := c.Sweep(); n != 1 || !b.disposed {
+		t.Errorf("second Sweep() of b = %d (disposed = %t), want 1 (true)", n, b.disposed)
+	}
+}
+
+func TestAssetCacheForget(t *testing.T) {
+	var c AssetCache
+	assets := fstest.MapFS{}
+	v, _ := c.Get(assets, "a", func() (any, int64, error) { return &fakeAsset{}, 1, nil })
+	old := v.(*fakeAsset)
+	c.Acquire(assets, "a")
+
+	c.Forget(assets, "a")
+	v, _ = c.Get(assets, "a", func() (any, int64, error) { return &fakeAsset{}, 1, nil })
+	if v == old {
+		t.Fatal("Get(a) after Forget returned the old value")
+	}
+	c.Acquire(assets, "a")
+	if old.disposed {
+		t.Error("old value disposed by Forget, want it left for Sweep")
+	}
+	if n := c.Sweep(); n != 0 || old.disposed {
+		t.Errorf("first Sweep() after Forget = %d (disposed = %t), want 0 (false)", n, old.disposed)
+	}
+	if n := c.Sweep(); n != 1 || !old.disposed {
+		t.Errorf("second Sweep() after Forget = %d (disposed = %t), want 1 (true)", n, old.disposed)
+	}
+	if v.(*fakeAsset).disposed {
+		t.Error("new value disposed, want it kept (acquired)")
+	}
+}
+
+func TestGameUpdateSweepsAssets(t *testing.T) {
+	g := &Game{Root: &DrawDFS{Child: MakeContainer()}}
+	if err := g.LoadAndPrepare(nil); err != nil {
+		t.Fatalf("LoadAndPrepare(nil) = %v, want nil", err)
+	}
+	v, _ := g.AssetCache().Get(nil, "a", func() (any, int64, error) { return &fakeAsset{}, 1, nil })
+	a := v.(*fakeAsset)
+
+	ticks := int(assetSweepInterval/tickDuration()) + 1
+	for i := 0; i < 2*ticks; i++ {
+		if err := g.Update(); err != nil {
+			t.Fatalf("Update() = %v, want nil", err)
+		}
+	}
+	if !a.disposed {
+		t.Error("unused asset not disposed after two sweep intervals of Update")
+	}
+}
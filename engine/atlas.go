@@ -0,0 +1,171 @@
+/*
+Copyright 2021 Josh Deprez
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// Ensure AtlasRef satisfies interfaces.
+var _ interface {
+	ContextLoader
+	Loader
+	Validator
+} = &AtlasRef{}
+
+func init() {
+	RegisterType(&AtlasRef{})
+}
+
+// Atlas describes a texture atlas: a single image containing many frames
+// (sprites, tiles, etc) of varying sizes, packed together. Atlases are made
+// with PackAtlas (or the atlaspack tool), and stored as JSON alongside the
+// image.
+type Atlas struct {
+	Image  string       `json:"image"` // path to the image, relative to the JSON file
+	Frames []AtlasFrame `json:"frames"`
+}
+
+// AtlasFrame describes a single frame within an atlas. Frames may be trimmed
+// (transparent borders removed before packing), in which case Offset and Size
+// describe how the trimmed image fits in the original frame.
+type AtlasFrame struct {
+	Name   string          `json:"name"`
+	Rect   image.Rectangle `json:"rect"`   // where the trimmed image is in the atlas image
+	Offset image.Point     `json:"offset"` // where the trimmed image is within the original frame
+	Size   image.Point     `json:"size"`   // size of the original frame
+	Pivot  image.Point     `json:"pivot"`  // point in the original frame to draw at the origin
+}
+
+// AtlasRef loads an atlas JSON file, for use by a Sheet (see Sheet.Atlas).
+// If Prefix is set, only frames with names beginning with Prefix are used,
+// so that many Sheets can share one atlas (and one texture). Cell indexes
+// refer to the frames in the order they appear in the atlas. Only Path and
+// Prefix are encoded.
+type AtlasRef struct {
+	Path   string
+	Prefix string
+
+	image  string // image path relative to the asset FS
+	frames []AtlasFrame
+	index  map[string]int
+}
+
+// Load loads the atlas. It does not use a cache.
+func (r *AtlasRef) Load(assets fs.FS) error {
+	return r.LoadContext(context.Background(), assets)
+}
+
+// LoadContext loads the atlas. If ctx carries an AssetCache, the parsed
+// atlas is shared with other AtlasRefs using the same path.
+func (r *AtlasRef) LoadContext(ctx context.Context, assets fs.FS) error {
+	load := func() (any, int64, error) { return loadAtlas(assets, r.Path) }
+	var v any
+	var err error
+	if cache := AssetCacheFrom(ctx); cache != nil {
+		v, err = cache.Get(assets, r.Path, load)
+	} else {
+		v, _, err = load()
+	}
+	if err != nil {
+		return err
+	}
+	a := v.(*Atlas)
+	r.image = path.Join(path.Dir(r.Path), a.Image)
+	r.frames = r.frames[:0]
+	r.index = make(map[string]int)
+	for _, f := range a.Frames {
+		if !strings.HasPrefix(f.Name, r.Prefix) {
+			continue
+		}
+		r.index[f.Name] = len(r.frames)
+		r.frames = append(r.frames, f)
+	}
+	if len(r.frames) == 0 {
+		return fmt.Errorf("%s: no frames with prefix %q", r.Path, r.Prefix)
+	}
+	return nil
+}
+
+// loadAtlas reads an atlas JSON file. It is an AssetLoadFunc (once the
+// arguments are supplied).
+func loadAtlas(assets fs.FS, p string) (any, int64, error) {
+	data, err := fs.ReadFile(assets, p)
+	if err != nil {
+		return nil, 0, err
+	}
+	a := new(Atlas)
+	if err := json.Unmarshal(data, a); err != nil {
+		return nil, 0, fmt.Errorf("%s: %w", p, err)
+	}
+	return a, int64(len(data)), nil
+}
+
+// Frame returns the frame for cell index i, and whether there is one (i is in
+// range). It is valid after loading.
+func (r *AtlasRef) Frame(i int) (AtlasFrame, bool) {
+	if i < 0 || i >= len(r.frames) {
+		return AtlasFrame{}, false
+	}
+	return r.frames[i], true
+}
+
+// Index returns the cell index of the frame with the given name (including
+// the prefix). It is valid after loading.
+func (r *AtlasRef) Index(name string) (int, bool) {
+	i, ok := r.index[name]
+	return i, ok
+}
+
+// Validate checks that the file at r.Path exists.
+func (r *AtlasRef) Validate(_ *Game, assets fs.FS) error {
+	if assets == nil {
+		return nil
+	}
+	_, err := fs.Stat(assets, r.Path)
+	return err
+}
+
+// apply sets s.Src.Path to the atlas image, and s.CellSize to the size of
+// the largest frame (so that grid-based components like Tilemap still work,
+// provided all the frames are the same size before trimming).
+func (r *AtlasRef) apply(s *Sheet) {
+	s.Src.Path = r.image
+	var size image.Point
+	for _, f := range r.frames {
+		if f.Size.X > size.X {
+			size.X = f.Size.X
+		}
+		if f.Size.Y > size.Y {
+			size.Y = f.Size.Y
+		}
+	}
+	s.CellSize = size
+}
+
+func (r *AtlasRef) String() string {
+	if r.Prefix == "" {
+		return "AtlasRef{" + r.Path + "}"
+	}
+	return "AtlasRef{" + r.Path + " " + r.Prefix + "}"
+}
@@ -0,0 +1,186 @@
+/*
+Copyright 2021 Josh Deprez
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"image"
+	"image/color"
+	"testing"
+	"testing/fstest"
+)
+
+// testSprite returns a size image with an opaque rectangle at r.
+func testSprite(size image.Point, r image.Rectangle, c color.NRGBA) *image.NRGBA {
+	img := image.NewNRGBA(image.Rectangle{Max: size})
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+func TestPackAtlas(t *testing.T) {
+	red := color.NRGBA{255, 0, 0, 255}
+	blue := color.NRGBA{0, 0, 255, 255}
+	sprites := []AtlasSprite{
+		{Name: "a", Image: testSprite(image.Pt(16, 16), image.Rect(4, 2, 10, 14), red), Pivot: image.Pt(8, 16)},
+		{Name: "b", Image: testSprite(image.Pt(8, 8), image.Rect(0, 0, 8, 8), blue)},
+		{Name: "c", Image: testSprite(image.Pt(4, 4), image.Rectangle{}, red)}, // fully transparent
+	}
+	img, atlas, err := PackAtlas(sprites, AtlasOptions{Padding: 1})
+	if err != nil {
+		t.Fatalf("PackAtlas() error = %v", err)
+	}
+	if len(atlas.Frames) != len(sprites) {
+		t.Fatalf("len(atlas.Frames) = %d, want %d", len(atlas.Frames), len(sprites))
+	}
+
+	a := atlas.Frames[0]
+	if a.Name != "a" || a.Offset != image.Pt(4, 2) || a.Size != image.Pt(16, 16) || a.Pivot != image.Pt(8, 16) {
+		t.Errorf("frame a = %+v, want name a, offset (4,2), size (16,16), pivot (8,16)", a)
+	}
+	if got, want := a.Rect.Size(), image.Pt(6, 12); got != want {
+		t.Errorf("frame a size = %v, want %v (trimmed)", got, want)
+	}
+	if got := img.NRGBAAt(a.Rect.Min.X, a.Rect.Min.Y); got != red {
+		t.Errorf("atlas pixel at frame a = %v, want %v", got, red)
+	}
+	b := atlas.Frames[1]
+	if got := img.NRGBAAt(b.Rect.Max.X-1, b.Rect.Max.Y-1); got != blue {
+		t.Errorf("atlas pixel at frame b = %v, want %v", got, blue)
+	}
+	if got, want := atlas.Frames[2].Rect.Size(), image.Pt(1, 1); got != want {
+		t.Errorf("frame c size = %v, want %v", got, want)
+	}
+
+	for i, f := range atlas.Frames {
+		if !f.Rect.In(img.Bounds()) {
+			t.Errorf("frame %d rect %v outside atlas %v", i, f.Rect, img.Bounds())
+		}
+		for j := i + 1; j < len(atlas.Frames); j++ {
+			if f.Rect.Overlaps(atlas.Frames[j].Rect) {
+				t.Errorf("frames %d and %d overlap: %v, %v", i, j, f.Rect, atlas.Frames[j].Rect)
+			}
+		}
+	}
+
+	if _, _, err := PackAtlas(sprites, AtlasOptions{MaxSize: 8}); err == nil {
+		t.Error("PackAtlas(MaxSize: 8) error = nil, want error")
+	}
+}
+
+func TestGridSprites(t *testing.T) {
+	sheet := testSprite(image.Pt(16, 8), image.Rect(8, 0, 16, 8), color.NRGBA{0, 255, 0, 255})
+	sprites := GridSprites("g/", sheet, image.Pt(8, 8))
+	if len(sprites) != 2 {
+		t.Fatalf("len(sprites) = %d, want 2", len(sprites))
+	}
+	if sprites[1].Name != "g/1" {
+		t.Errorf("sprites[1].Name = %q, want g/1", sprites[1].Name)
+	}
+	if got, want := opaqueBounds(sprites[1].Image), image.Rect(8, 0, 16, 8); got != want {
+		t.Errorf("opaqueBounds(sprites[1]) = %v, want %v", got, want)
+	}
+}
+
+func TestSheetLoadAtlas(t *testing.T) {
+	atlas := &Atlas{
+		Image: "atlas.png",
+		Frames: []AtlasFrame{
+			{Name: "box", Rect: image.Rect(0, 0, 8, 8), Size: image.Pt(8, 8)},
+			{Name: "aw/0", Rect: image.Rect(8, 0, 14, 12), Offset: image.Pt(1, 4), Size: image.Pt(10, 16), Pivot: image.Pt(5, 16)},
+			{Name: "aw/1", Rect: image.Rect(14, 0, 22, 16), Size: image.Pt(10, 16)},
+		},
+	}
+	data, err := json.Marshal(atlas)
+	if err != nil {
+		t.Fatalf("json.Marshal(atlas) = %v", err)
+	}
+	assets := fstest.MapFS{"sprites/atlas.json": {Data: data}}
+
+	cache := new(AssetCache)
+	ctx := WithAssetCache(context.Background(), cache)
+	s := &Sheet{Atlas: &AtlasRef{Path: "sprites/atlas.json", Prefix: "aw/"}}
+	if err := s.LoadContext(ctx, assets); err != nil {
+		t.Fatalf("Sheet.LoadContext() = %v", err)
+	}
+	if got, want := s.Src.Path, "sprites/atlas.png"; got != want {
+		t.Errorf("Src.Path = %q, want %q", got, want)
+	}
+	if got, want := s.CellSize, image.Pt(10, 16); got != want {
+		t.Errorf("CellSize = %v, want %v", got, want)
+	}
+	if i, ok := s.CellIndex("aw/1"); !ok || i != 1 {
+		t.Errorf("CellIndex(aw/1) = %d, %t, want 1, true", i, ok)
+	}
+	if _, ok := s.CellIndex("box"); ok {
+		t.Error("CellIndex(box) ok = true, want false (filtered by prefix)")
+	}
+	if got, want := s.CellOffset(0), image.Pt(-4, -12); got != want {
+		t.Errorf("CellOffset(0) = %v, want %v", got, want)
+	}
+	for _, i := range []int{-1, 2} {
+		if f, ok := s.Atlas.Frame(i); ok {
+			t.Errorf("Atlas.Frame(%d) = %v, true, want false", i, f)
+		}
+		if got := s.CellOffset(i); got != (image.Point{}) {
+			t.Errorf("CellOffset(%d) = %v, want (0, 0)", i, got)
+		}
+	}
+
+	// Anim steps must refer to frames in the atlas.
+	s.AnimDefs = map[string]*AnimDef{
+		"ok": {Steps: []AnimStep{{Cell: 0}, {Cell: 1}}},
+	}
+	if err := s.Validate(nil, nil); err != nil {
+		t.Errorf("Sheet.Validate() = %v, want nil", err)
+	}
+	s.AnimDefs["bad"] = &AnimDef{Steps: []AnimStep{{Cell: 1}, {Cell: 2}}}
+	if err := s.Validate(nil, nil); err == nil {
+		t.Error("Sheet.Validate(cell 2 of 2 frames) = nil, want error")
+	}
+
+	// A second sheet using the same atlas shares the parsed file.
+	s2 := &Sheet{Atlas: &AtlasRef{Path: "sprites/atlas.json", Prefix: "box"}}
+	if err := s2.LoadContext(ctx, assets); err != nil {
+		t.Fatalf("Sheet.LoadContext() = %v", err)
+	}
+	if got, want := cache.Stats().Entries, 1; got != want {
+		t.Errorf("cache entries = %d, want %d", got, want)
+	}
+
+	bad := &Sheet{Atlas: &AtlasRef{Path: "sprites/atlas.json", Prefix: "nope"}}
+	if err := bad.LoadContext(ctx, assets); err == nil {
+		t.Error("Sheet.LoadContext(prefix nope) = nil, want error")
+	}
+
+	// Aseprite cells are grid cells, so can't be combined with an atlas.
+	both := &Sheet{
+		Aseprite: &AsepriteRef{Path: "sprites/aw.json"},
+		Atlas:    &AtlasRef{Path: "sprites/atlas.json"},
+		CellSize: image.Pt(10, 16),
+	}
+	if err := both.Validate(nil, nil); err == nil {
+		t.Error("Sheet.Validate(Aseprite and Atlas) = nil, want error")
+	}
+	if err := both.LoadContext(ctx, assets); err == nil {
+		t.Error("Sheet.LoadContext(Aseprite and Atlas) = nil, want error")
+	}
+}
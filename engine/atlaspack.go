@@ -0,0 +1,185 @@
+/*
+Copyright 2021 Josh Deprez
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"sort"
+)
+
+// AtlasSprite is an input to PackAtlas.
+type AtlasSprite struct {
+	Name  string
+	Image image.Image
+	Pivot image.Point // relative to Image.Bounds().Min
+}
+
+// AtlasOptions control PackAtlas.
+type AtlasOptions struct {
+	MaxSize int  // maximum width and height of the atlas image (default 4096)
+	Padding int  // transparent pixels between frames
+	NoTrim  bool // don't trim transparent borders from frames
+}
+
+// DefaultAtlasMaxSize is the maximum atlas size used if AtlasOptions.MaxSize
+// is not set. Most GPUs support textures at least this large.
+const DefaultAtlasMaxSize = 4096
+
+// GridSprites splits a grid-based sheet image into AtlasSprites, one per
+// cell, named name followed by the cell index (e.g. "aw/0", "aw/1", ...
+// for name "aw/"). This is useful for moving existing sheets into an atlas.
+func GridSprites(name string, img image.Image, cellSize image.Point) []AtlasSprite {
+	b := img.Bounds()
+	cols, rows := b.Dx()/cellSize.X, b.Dy()/cellSize.Y
+	sprites := make([]AtlasSprite, 0, cols*rows)
+	for i := 0; i < cols*rows; i++ {
+		min := b.Min.Add(image.Pt(i%cols*cellSize.X, i/cols*cellSize.Y))
+		sprites = append(sprites, AtlasSprite{
+			Name:  fmt.Sprintf("%s%d", name, i),
+			Image: subImage(img, image.Rectangle{min, min.Add(cellSize)}),
+		})
+	}
+	return sprites
+}
+
+// PackAtlas packs sprites into a single image. The frames in the returned
+// Atlas are in the same order as sprites. The caller should set the Image
+// field of the Atlas to wherever the image will be saved. Packing uses a
+// simple shelf algorithm: sprites are sorted by height and placed in rows,
+// trying successively wider images until everything fits.
+func PackAtlas(sprites []AtlasSprite, opts AtlasOptions) (*image.NRGBA, *Atlas, error) {
+	if len(sprites) == 0 {
+		return nil, nil, errors.New("no sprites to pack")
+	}
+	maxSize := opts.MaxSize
+	if maxSize <= 0 {
+		maxSize = DefaultAtlasMaxSize
+	}
+
+	// Trim each sprite, and work out the starting width.
+	atlas := &Atlas{Frames: make([]AtlasFrame, len(sprites))}
+	src := make([]image.Rectangle, len(sprites)) // trimmed bounds
+	area, widest := 0, 0
+	for i, s := range sprites {
+		b := s.Image.Bounds()
+		t := b
+		if !opts.NoTrim {
+			t = opaqueBounds(s.Image)
+		}
+		src[i] = t
+		atlas.Frames[i] = AtlasFrame{
+			Name:   s.Name,
+			Offset: t.Min.Sub(b.Min),
+			Size:   b.Size(),
+			Pivot:  s.Pivot,
+		}
+		w, h := t.Dx()+opts.Padding, t.Dy()+opts.Padding
+		area += w * h
+		if w > widest {
+			widest = w
+		}
+	}
+	width := 1
+	for width < widest || width*width < area {
+		width *= 2
+	}
+
+	// Tallest first.
+	order := make([]int, len(sprites))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return src[order[a]].Dy() > src[order[b]].Dy()
+	})
+
+	for ; width <= maxSize; width *= 2 {
+		pos, height, ok := shelfPack(order, src, width, maxSize, opts.Padding)
+		if !ok {
+			continue
+		}
+		img := image.NewNRGBA(image.Rect(0, 0, width, height))
+		for i, s := range sprites {
+			r := image.Rectangle{pos[i], pos[i].Add(src[i].Size())}
+			draw.Draw(img, r, s.Image, src[i].Min, draw.Src)
+			atlas.Frames[i].Rect = r
+		}
+		return img, atlas, nil
+	}
+	return nil, nil, fmt.Errorf("sprites don't fit in a %dx%d atlas", maxSize, maxSize)
+}
+
+// shelfPack places rectangles (in the given order) into rows of the given
+// width. It returns the position of each rectangle and the total height, or
+// false if the height would exceed maxHeight.
+func shelfPack(order []int, rects []image.Rectangle, width, maxHeight, padding int) ([]image.Point, int, bool) {
+	pos := make([]image.Point, len(rects))
+	x, y, rowHeight := 0, 0, 0
+	for _, i := range order {
+		w, h := rects[i].Dx(), rects[i].Dy()
+		if w > width {
+			return nil, 0, false
+		}
+		if x+w > width {
+			// Next row.
+			x, y, rowHeight = 0, y+rowHeight+padding, 0
+		}
+		pos[i] = image.Pt(x, y)
+		x += w + padding
+		if h > rowHeight {
+			rowHeight = h
+		}
+	}
+	height := y + rowHeight
+	return pos, height, height <= maxHeight
+}
+
+// opaqueBounds returns the smallest rectangle containing all the
+// non-transparent pixels of img. If img is entirely transparent, it returns a
+// single pixel rectangle, so that every frame has an image.
+func opaqueBounds(img image.Image) image.Rectangle {
+	b := img.Bounds()
+	r := image.Rectangle{}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if _, _, _, a := img.At(x, y).RGBA(); a == 0 {
+				continue
+			}
+			r = r.Union(image.Rect(x, y, x+1, y+1))
+		}
+	}
+	if r.Empty() {
+		return image.Rectangle{b.Min, b.Min.Add(image.Pt(1, 1))}.Intersect(b)
+	}
+	return r
+}
+
+// subImage returns the part of img within r, using img's SubImage method if
+// it has one.
+func subImage(img image.Image, r image.Rectangle) image.Image {
+	if s, ok := img.(interface {
+		SubImage(image.Rectangle) image.Image
+	}); ok {
+		return s.SubImage(r)
+	}
+	dst := image.NewNRGBA(r)
+	draw.Draw(dst, r, img, r.Min, draw.Src)
+	return dst
+}
@@ -0,0 +1,467 @@
+/*
+Copyright 2021 Josh Deprez
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hajimehoshi/ebiten/v2/audio"
+	"github.com/hajimehoshi/ebiten/v2/audio/vorbis"
+	"github.com/hajimehoshi/ebiten/v2/audio/wav"
+)
+
+// Ensure SoundRef and MusicRef satisfy interfaces.
+var _ interface {
+	ContextLoader
+	Disposer
+	Loader
+	Prepper
+	Registeree
+	Validator
+} = &SoundRef{}
+
+var _ interface {
+	ContextLoader
+	Disposer
+	Loader
+	Prepper
+	Registeree
+	Validator
+} = &MusicRef{}
+
+func init() {
+	RegisterType(&SoundRef{})
+	RegisterType(&MusicRef{})
+}
+
+// Mixer returns the game's audio mixer, creating it if needed. Once the mixer
+// exists, Update starts audio output (reading from the mixer), and pauses
+// voices started by components (such as SoundRef and MusicRef) while the game,
+// the component, or any of its ancestors is disabled.
+func (g *Game) Mixer() *Mixer {
+	g.audiomu.Lock()
+	defer g.audiomu.Unlock()
+	if g.mixer == nil {
+		g.mixer = new(Mixer)
+	}
+	return g.mixer
+}
+
+// audioOutput plays the game's mixer through the ebiten audio context.
+type audioOutput struct {
+	player *audio.Player
+	failed bool // don't keep trying to start audio
+}
+
+// updateAudio starts audio output if needed, and pauses or unpauses voices
+// belonging to disabled components.
+func (g *Game) updateAudio() {
+	g.audiomu.Lock()
+	m := g.mixer
+	if m != nil && g.audioOut.player == nil && !g.audioOut.failed {
+		if err := g.audioOut.start(m); err != nil {
+			g.audioOut.failed = true
+			g.Log(LevelError, "couldn't start audio", F("err", err))
+			m.discardAll()
+		}
+	}
+	g.audiomu.Unlock()
+	if m == nil {
+		return
+	}
+	m.hold(g.audioHeld)
+}
+
+// start creates a player reading from m. g.audiomu must be held.
+func (o *audioOutput) start(m *Mixer) error {
+	ctx := audio.CurrentContext()
+	if ctx == nil {
+		ctx = audio.NewContext(AudioSampleRate)
+	}
+	if sr := ctx.SampleRate(); sr != AudioSampleRate {
+		return fmt.Errorf("audio context sample rate is %d, want %d", sr, AudioSampleRate)
+	}
+	p, err := ctx.NewPlayer(m)
+	if err != nil {
+		return err
+	}
+	p.Play()
+	o.player = p
+	return nil
+}
+
+// audioHeld reports whether audio belonging to owner should be paused: if
+// the game, owner, or any ancestor of owner is disabled.
+func (g *Game) audioHeld(owner any) bool {
+	if g.Disabled() {
+		return true
+	}
+	for _, c := range g.ReversePath(owner) {
+		if d, ok := c.(Disabler); ok && d.Disabled() {
+			return true
+		}
+	}
+	return false
+}
+
+// audioRef holds the parts common to SoundRef and MusicRef.
+type audioRef struct {
+	clip   *AudioClip
+	mixer  *Mixer
+	path   string      // where clip came from
+	assets fs.FS       // where clip came from
+	cache  *AssetCache // cache holding clip, if any
+	held   bool        // whether a reference to the cache entry is held
+	mu     sync.Mutex  // guards volume, volSet, SoundRef.voices and MusicRef.voice
+	volume float64
+	volSet bool // false means volume = 1
+}
+
+// load loads the clip. As with ImageRef, the clip is only cached if ctx
+// carries an AssetCache.
+func (a *audioRef) load(ctx context.Context, assets fs.FS, p string) error {
+	load := func() (any, int64, error) { return loadAudioClip(assets, p) }
+	cache := AssetCacheFrom(ctx)
+	if cache == nil {
+		v, _, err := load()
+		if err != nil {
+			return err
+		}
+		a.release()
+		a.clip, a.path, a.assets, a.cache = v.(*AudioClip), p, assets, nil
+		return nil
+	}
+	v, err := cache.Get(assets, p, load)
+	if err != nil {
+		return err
+	}
+	// Swap any previously held reference for one to the new clip.
+	wasHeld := a.held
+	a.release()
+	a.clip, a.path, a.assets, a.cache = v.(*AudioClip), p, assets, cache
+	if wasHeld {
+		a.acquire()
+	}
+	return nil
+}
+
+// acquire acquires a reference to the cached clip, so it is kept in the
+// cache while the component is registered.
+func (a *audioRef) acquire() {
+	if a.cache == nil || a.held {
+		return
+	}
+	a.held = a.cache.Acquire(a.assets, a.path)
+}
+
+// release releases the reference to the cached clip (if held).
+func (a *audioRef) release() {
+	if !a.held {
+		return
+	}
+	a.cache.Release(a.assets, a.path)
+	a.held = false
+}
+
+func (a *audioRef) getVolume() float64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if !a.volSet {
+		return 1
+	}
+	return a.volume
+}
+
+func (a *audioRef) setVolume(v float64) {
+	a.mu.Lock()
+	a.volume, a.volSet = math.Max(v, 0), true
+	a.mu.Unlock()
+}
+
+// validateAudio checks that an audio file exists and has a known extension.
+func validateAudio(assets fs.FS, p string) error {
+	if _, err := audioDecoder(p); err != nil {
+		return err
+	}
+	if assets == nil {
+		return nil
+	}
+	_, err := fs.Stat(assets, p)
+	return err
+}
+
+// SoundRef loads a sound effect (WAV or Ogg Vorbis) from the asset FS. Play
+// can be called any number of times, and the sounds overlap. Sounds are
+// decoded into memory when loaded, and shared through the asset cache.
+type SoundRef struct {
+	Path string
+	Bus  string // defaults to SoundBus
+
+	audioRef
+	voices []*Voice // guarded by audioRef.mu
+}
+
+// Load loads the sound without a cache.
+func (r *SoundRef) Load(assets fs.FS) error {
+	return r.LoadContext(context.Background(), assets)
+}
+
+// LoadContext loads the sound, using the AssetCache in ctx (if any).
+func (r *SoundRef) LoadContext(ctx context.Context, assets fs.FS) error {
+	return r.load(ctx, assets, r.Path)
+}
+
+// Prepare obtains the game's mixer.
+func (r *SoundRef) Prepare(game *Game) error {
+	r.mixer = game.Mixer()
+	return nil
+}
+
+// Play starts playing the sound, and returns the new voice. It returns nil
+// if the sound is not loaded and prepared.
+func (r *SoundRef) Play() *Voice {
+	if r.mixer == nil || r.clip == nil {
+		return nil
+	}
+	v := r.mixer.play(r.clip, busOrDefault(r.Bus, SoundBus), false, r.Volume(), r)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	live := r.voices[:0]
+	for _, old := range r.voices {
+		if old.Playing() {
+			live = append(live, old)
+		}
+	}
+	r.voices = append(live, v)
+	return v
+}
+
+// Stop stops all playing instances of the sound.
+func (r *SoundRef) Stop() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, v := range r.voices {
+		v.Stop()
+	}
+	r.voices = nil
+}
+
+// Volume returns the volume of the sound. The default is 1.
+func (r *SoundRef) Volume() float64 { return r.getVolume() }
+
+// SetVolume sets the volume for future and currently playing instances of
+// the sound.
+func (r *SoundRef) SetVolume(v float64) {
+	r.setVolume(v)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, voice := range r.voices {
+		voice.SetVolume(v)
+	}
+}
+
+// Registered acquires a reference to the cached clip.
+func (r *SoundRef) Registered(any) { r.acquire() }
+
+// Dispose stops the sound, and releases the reference to the cached clip.
+func (r *SoundRef) Dispose() {
+	r.Stop()
+	r.release()
+}
+
+// Validate checks that the file at r.Path exists and is a supported format.
+func (r *SoundRef) Validate(_ *Game, assets fs.FS) error {
+	return validateAudio(assets, r.Path)
+}
+
+func (r *SoundRef) String() string { return "SoundRef{" + r.Path + "}" }
+
+// MusicRef loads a music track (WAV or Ogg Vorbis) from the asset FS. Unlike
+// SoundRef, only one instance of the track plays at a time, and it loops
+// unless OneShot is set. Like SoundRef, the whole track is decoded into
+// memory when loaded.
+type MusicRef struct {
+	Path    string
+	Bus     string // defaults to MusicBus
+	OneShot bool   // play once, instead of looping
+
+	audioRef
+	voice *Voice // guarded by audioRef.mu
+}
+
+// Load loads the track without a cache.
+func (r *MusicRef) Load(assets fs.FS) error {
+	return r.LoadContext(context.Background(), assets)
+}
+
+// LoadContext loads the track, using the AssetCache in ctx (if any).
+func (r *MusicRef) LoadContext(ctx context.Context, assets fs.FS) error {
+	return r.load(ctx, assets, r.Path)
+}
+
+// Prepare obtains the game's mixer.
+func (r *MusicRef) Prepare(game *Game) error {
+	r.mixer = game.Mixer()
+	return nil
+}
+
+// Play starts playing the track from the beginning, at the track's volume (see
+// Volume), unless it is already playing.
+func (r *MusicRef) Play() { r.start(r.Volume()) }
+
+// FadeIn starts playing the track (unless already playing), fading in from
+// silence over the duration d.
+func (r *MusicRef) FadeIn(d time.Duration) {
+	r.start(0)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.voice.FadeTo(r.getVolumeLocked(), d)
+}
+
+func (r *MusicRef) start(volume float64) {
+	if r.mixer == nil || r.clip == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.voice.Playing() {
+		return
+	}
+	r.voice = r.mixer.play(r.clip, busOrDefault(r.Bus, MusicBus), !r.OneShot, volume, r)
+}
+
+// Playing reports whether the track is playing (including while paused or
+// fading out).
+func (r *MusicRef) Playing() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.voice.Playing()
+}
+
+// Stop stops the track immediately.
+func (r *MusicRef) Stop() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.voice.Stop()
+	r.voice = nil
+}
+
+// FadeOut fades the track to silence over the duration d, and then stops it.
+func (r *MusicRef) FadeOut(d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.voice.FadeOut(d)
+}
+
+// CrossfadeTo fades this track out and next in, at the same time, over the
+// duration d.
+func (r *MusicRef) CrossfadeTo(next *MusicRef, d time.Duration) {
+	r.FadeOut(d)
+	next.FadeIn(d)
+}
+
+// Volume returns the volume of the track. The default is 1.
+func (r *MusicRef) Volume() float64 { return r.getVolume() }
+
+// SetVolume sets the volume of the track, cancelling any fade in progress.
+func (r *MusicRef) SetVolume(v float64) {
+	r.setVolume(v)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.voice.SetVolume(v)
+}
+
+func (r *MusicRef) getVolumeLocked() float64 {
+	if !r.volSet {
+		return 1
+	}
+	return r.volume
+}
+
+// Registered acquires a reference to the cached clip.
+func (r *MusicRef) Registered(any) { r.acquire() }
+
+// Dispose stops the track, and releases the reference to the cached clip.
+func (r *MusicRef) Dispose() {
+	r.Stop()
+	r.release()
+}
+
+// Validate checks that the file at r.Path exists and is a supported format.
+func (r *MusicRef) Validate(_ *Game, assets fs.FS) error {
+	return validateAudio(assets, r.Path)
+}
+
+func (r *MusicRef) String() string { return "MusicRef{" + r.Path + "}" }
+
+func busOrDefault(bus, def string) string {
+	if bus == "" {
+		return def
+	}
+	return bus
+}
+
+// audioDecoder returns a decoder for the file, based on the extension.
+func audioDecoder(p string) (func(io.Reader) (io.Reader, error), error) {
+	switch strings.ToLower(path.Ext(p)) {
+	case ".wav":
+		return func(r io.Reader) (io.Reader, error) {
+			return wav.DecodeWithSampleRate(AudioSampleRate, r)
+		}, nil
+	case ".ogg", ".oga":
+		return func(r io.Reader) (io.Reader, error) {
+			return vorbis.DecodeWithSampleRate(AudioSampleRate, r)
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported audio format %q", path.Ext(p))
+}
+
+// loadAudioClip decodes an audio file into an *AudioClip. It is an
+// AssetLoadFunc (once the arguments are supplied).
+func loadAudioClip(assets fs.FS, p string) (any, int64, error) {
+	decode, err := audioDecoder(p)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s: %w", p, err)
+	}
+	data, err := fs.ReadFile(assets, p)
+	if err != nil {
+		return nil, 0, err
+	}
+	stream, err := decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s: %w", p, err)
+	}
+	pcm, err := io.ReadAll(stream)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s: %w", p, err)
+	}
+	clip := &AudioClip{Samples: make([]int16, len(pcm)/2)}
+	for i := range clip.Samples {
+		clip.Samples[i] = int16(binary.LittleEndian.Uint16(pcm[2*i:]))
+	}
+	return clip, int64(len(pcm)), nil
+}
@@ -0,0 +1,262 @@
+/*
+Copyright 2021 Josh Deprez
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// constClip returns a clip of n frames where every sample is s.
+func constClip(n int, s int16) *AudioClip {
+	c := &AudioClip{Samples: make([]int16, 2*n)}
+	for i := range c.Samples {
+		c.Samples[i] = s
+	}
+	return c
+}
+
+// render reads n frames from m, and returns the left channel.
+func render(t *testing.T, m *Mixer, n int) []int16 {
+	t.Helper()
+	p := make([]byte, 4*n)
+	if got, err := m.Read(p); err != nil || got != len(p) {
+		t.Fatalf("m.Read(%d bytes) = %d, %v, want %d, nil", len(p), got, err, len(p))
+	}
+	out := make([]int16, n)
+	for i := range out {
+		out[i] = int16(binary.LittleEndian.Uint16(p[4*i:]))
+	}
+	return out
+}
+
+// framesDuration returns the duration of n frames.
+func framesDuration(n int) time.Duration {
+	return time.Duration(n) * time.Second / AudioSampleRate
+}
+
+// testWAV encodes samples as a 16-bit stereo WAV file at AudioSampleRate.
+func testWAV(samples []int16) []byte {
+	var buf bytes.Buffer
+	w := func(v any) { binary.Write(&buf, binary.LittleEndian, v) }
+	buf.WriteString("RIFF")
+	w(uint32(36 + 2*len(samples)))
+	buf.WriteString("WAVEfmt ")
+	w(uint32(16))
+	w(uint16(1)) // PCM
+	w(uint16(2)) // channels
+	w(uint32(AudioSampleRate))
+	w(uint32(AudioSampleRate * 4))
+	w(uint16(4))  // block align
+	w(uint16(16)) // bits per sample
+	buf.WriteString("data")
+	w(uint32(2 * len(samples)))
+	w(samples)
+	return buf.Bytes()
+}
+
+func TestMixerBusesAndVolume(t *testing.T) {
+	m := new(Mixer)
+	m.SetVolume(SoundBus, 0.5)
+	m.SetVolume(MasterBus, 0.5)
+	m.Play(constClip(3, 1000), SoundBus, false)
+	m.Play(constClip(2, 1000), MusicBus, false)
+
+	want := []int16{750, 750, 250, 0, 0}
+	if diff := cmp.Diff(render(t, m, 5), want); diff != "" {
+		t.Errorf("render diff (-got +want):\n%s", diff)
+	}
+	if got := m.Voices(); got != 0 {
+		t.Errorf("m.Voices() = %d, want 0 (all finished)", got)
+	}
+}
+
+func TestMixerMasterBus(t *testing.T) {
+	m := new(Mixer)
+	m.SetVolume(MasterBus, 0.5)
+	m.Play(constClip(2, 1000), MasterBus, false)
+	want := []int16{500, 500}
+	if diff := cmp.Diff(render(t, m, 2), want); diff != "" {
+		t.Errorf("render diff (-got +want):\n%s", diff)
+	}
+}
+
+func TestMixerLoopAndClamp(t *testing.T) {
+	m := new(Mixer)
+	clip := &AudioClip{Samples: []int16{20000, 0, 30000, 0}}
+	v := m.Play(clip, SoundBus, true)
+	m.Play(constClip(4, 20000), SoundBus, false)
+
+	want := []int16{32767, 32767, 32767, 32767, 20000}
+	if diff := cmp.Diff(render(t, m, 5), want); diff != "" {
+		t.Errorf("render diff (-got +want):\n%s", diff)
+	}
+	if !v.Playing() {
+		t.Error("looping voice stopped, want still playing")
+	}
+	v.Stop()
+	if got := render(t, m, 10); got[9] != 0 {
+		t.Errorf("render after Stop = %v, want silence at end", got)
+	}
+}
+
+func TestMixerPause(t *testing.T) {
+	m := new(Mixer)
+	m.Play(&AudioClip{Samples: []int16{1, 0, 2, 0, 3, 0}}, MusicBus, false)
+	m.Pause(MusicBus)
+	if diff := cmp.Diff(render(t, m, 2), []int16{0, 0}); diff != "" {
+		t.Errorf("render while paused diff (-got +want):\n%s", diff)
+	}
+	m.Resume(MusicBus)
+	m.Pause(MasterBus)
+	render(t, m, 2)
+	m.Resume(MasterBus)
+	// Resumes from where it was.
+	if diff := cmp.Diff(render(t, m, 4), []int16{1, 2, 3, 0}); diff != "" {
+		t.Errorf("render after resume diff (-got +want):\n%s", diff)
+	}
+}
+
+func TestMixerWithoutOutput(t *testing.T) {
+	m := new(Mixer)
+	clip := constClip(10, 1)
+	for i := 0; i < 100; i++ {
+		m.Play(clip, SoundBus, false).Stop()
+	}
+	if got := len(m.voices); got > 1 {
+		t.Errorf("len(m.voices) after stopping 100 voices = %d, want at most 1", got)
+	}
+
+	m.Play(clip, SoundBus, true)
+	m.discardAll()
+	if v := m.Play(clip, SoundBus, true); v.Playing() {
+		t.Error("Play() after discardAll: v.Playing() = true, want false")
+	}
+	if got := m.Voices(); got != 0 {
+		t.Errorf("m.Voices() after discardAll = %d, want 0", got)
+	}
+}
+
+func TestVoiceFade(t *testing.T) {
+	m := new(Mixer)
+	v := m.Play(constClip(100, 10000), SoundBus, false)
+	v.FadeOut(framesDuration(4))
+	want := []int16{10000, 7500, 5000, 2500, 0, 0}
+	if diff := cmp.Diff(render(t, m, 6), want); diff != "" {
+		t.Errorf("render diff (-got +want):\n%s", diff)
+	}
+	if v.Playing() {
+		t.Error("v.Playing() = true after FadeOut, want false")
+	}
+
+	v = m.Play(constClip(100, 10000), SoundBus, false)
+	v.SetVolume(0)
+	v.FadeTo(1, framesDuration(2))
+	want = []int16{0, 5000, 10000, 10000}
+	if diff := cmp.Diff(render(t, m, 4), want); diff != "" {
+		t.Errorf("render diff (-got +want):\n%s", diff)
+	}
+}
+
+func TestSoundRefAndMusicRef(t *testing.T) {
+	assets := fstest.MapFS{
+		"a.wav": {Data: testWAV([]int16{100, 100, 200, 200})},
+		"b.wav": {Data: testWAV([]int16{1000, 1000})},
+	}
+	sound := &SoundRef{Path: "a.wav"}
+	music := &MusicRef{Path: "b.wav"}
+	scene := &Scene{ID: "level", Child: MakeContainer(sound, music)}
+	g := &Game{Root: &DrawDFS{Child: scene}}
+	if err := g.LoadAndPrepare(assets); err != nil {
+		t.Fatalf("LoadAndPrepare() = %v", err)
+	}
+	if got, want := g.AssetCache().Stats().Entries, 2; got != want {
+		t.Errorf("asset cache entries = %d, want %d", got, want)
+	}
+
+	m := g.Mixer()
+	sound.Play()
+	sound.Play()
+	sound.SetVolume(0.5)
+	music.Play()
+	music.Play() // already playing: no effect
+	want := []int16{1100, 1200, 1000, 1000}
+	if diff := cmp.Diff(render(t, m, 4), want); diff != "" {
+		t.Errorf("render diff (-got +want):\n%s", diff)
+	}
+
+	// Disabling an ancestor pauses the music.
+	scene.Disable()
+	m.hold(g.audioHeld)
+	if diff := cmp.Diff(render(t, m, 2), []int16{0, 0}); diff != "" {
+		t.Errorf("render while disabled diff (-got +want):\n%s", diff)
+	}
+	scene.Enable()
+	m.hold(g.audioHeld)
+
+	// Crossfade to another track.
+	other := &MusicRef{Path: "a.wav"}
+	if err := g.Load(other, assets); err != nil {
+		t.Fatalf("Load(other) = %v", err)
+	}
+	other.Prepare(g)
+	music.CrossfadeTo(other, framesDuration(2))
+	want = []int16{1000, 600, 100, 200}
+	if diff := cmp.Diff(render(t, m, 4), want); diff != "" {
+		t.Errorf("render crossfade diff (-got +want):\n%s", diff)
+	}
+	if music.Playing() || !other.Playing() {
+		t.Errorf("after crossfade, music.Playing() = %t, other.Playing() = %t, want false, true", music.Playing(), other.Playing())
+	}
+
+	other.Dispose()
+	if got := m.Voices(); got != 0 {
+		t.Errorf("m.Voices() after Dispose = %d, want 0", got)
+	}
+
+	// Registered refs keep their clips in the cache.
+	cache := g.AssetCache()
+	cache.Sweep()
+	if got := cache.Sweep(); got != 0 {
+		t.Errorf("Sweep() while registered = %d, want 0", got)
+	}
+	g.Unregister(scene)
+	if got, want := cache.Sweep(), 2; got != want {
+		t.Errorf("Sweep() after Unregister = %d, want %d", got, want)
+	}
+}
+
+func TestSoundRefSurvivesRebuild(t *testing.T) {
+	assets := fstest.MapFS{
+		"a.wav": {Data: testWAV([]int16{100, 100})},
+	}
+	sound := &SoundRef{Path: "a.wav"}
+	g := &Game{Root: &DrawDFS{Child: MakeContainer(sound)}}
+	for i := 0; i < 2; i++ {
+		if err := g.LoadAndPrepare(assets); err != nil {
+			t.Fatalf("LoadAndPrepare() #%d = %v", i, err)
+		}
+	}
+	if got, want := g.AssetCache().Stats(), (AssetCacheStats{Entries: 1, Bytes: 4}); got != want {
+		t.Errorf("asset cache stats = %+v, want %+v", got, want)
+	}
+}
@@ -17,7 +17,6 @@ limitations under the License.
 package engine
 
 import (
-	"encoding/gob"
 	"fmt"
 
 	"github.com/DrJosh9000/ichigo/geom"
@@ -34,15 +33,16 @@ var _ interface {
 } = &Billboard{}
 
 func init() {
-	gob.Register(&Billboard{})
+	RegisterType(&Billboard{})
 }
 
 // Billboard draws an image at a position.
 type Billboard struct {
 	ID
 	Hides
-	Pos geom.Int3
-	Src ImageRef
+	Pos    geom.Int3
+	Src    ImageRef
+	Sounds []*SoundEmitter // sounds emitted from the billboard's position
 
 	game *Game
 }
@@ -67,9 +67,17 @@ func (b *Billboard) Prepare(g *Game) error {
 	return nil
 }
 
-// Scan visits &b.Src.
+// Scan visits &b.Src and each of b.Sounds.
 func (b *Billboard) Scan(visit VisitFunc) error {
-	return visit(&b.Src)
+	if err := visit(&b.Src); err != nil {
+		return err
+	}
+	for _, e := range b.Sounds {
+		if err := visit(e); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // String returns "Billboard@(b.Pos)".
@@ -17,7 +17,6 @@ limitations under the License.
 package engine
 
 import (
-	"encoding/gob"
 	"image"
 
 	"github.com/DrJosh9000/ichigo/geom"
@@ -33,7 +32,7 @@ var _ interface {
 } = &Camera{}
 
 func init() {
-	gob.Register(&Camera{})
+	RegisterType(&Camera{})
 }
 
 // Camera models a camera that is viewing something.
@@ -0,0 +1,160 @@
+/*
+Copyright 2022 Josh Deprez
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import (
+	"math"
+	"time"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+var _ interface {
+	Scanner
+	TimeScaler
+} = &TimeWarp{}
+
+func init() {
+	RegisterType(&TimeWarp{})
+}
+
+// defaultTPS is used when ebiten isn't running at a fixed TPS.
+const defaultTPS = 60
+
+// Tick returns the number of simulation steps that have run so far. It
+// increases by one for each step of the game's clock, so it stops increasing
+// while the time scale is 0 (see SetTimeScale).
+func (g *Game) Tick() uint64 { return g.tick }
+
+// Elapsed returns the amount of simulated time that has passed (the number of
+// ticks multiplied by the step duration).
+func (g *Game) Elapsed() time.Duration {
+	return time.Duration(g.tick) * g.stepDuration()
+}
+
+// TimeScale returns the global time scale factor. The default is 1.
+func (g *Game) TimeScale() float64 {
+	if !g.timeScaleSet {
+		return 1
+	}
+	return g.timeScale
+}
+
+// SetTimeScale sets the global time scale factor. For example, 0.5 runs the
+// simulation at half speed (slow motion), 2 runs it at double speed, and 0
+// freezes it (hit-stop). Negative values are treated as 0.
+func (g *Game) SetTimeScale(s float64) {
+	g.timeScale, g.timeScaleSet = math.Max(s, 0), true
+}
+
+// stepDuration returns g.Step, or the duration of one ebiten tick if g.Step is
+// not set.
+func (g *Game) stepDuration() time.Duration {
+	if g.Step > 0 {
+		return g.Step
+	}
+	return tickDuration()
+}
+
+// tickDuration returns the real time between calls to Update.
+func tickDuration() time.Duration {
+	tps := ebiten.MaxTPS()
+	if tps <= 0 {
+		tps = defaultTPS
+	}
+	return time.Second / time.Duration(tps)
+}
+
+// stepsFor converts a duration to a number of simulation steps (at least 1),
+// using the step duration that physics updates (such as Anim.Update) advance
+// by.
+func (g *Game) stepsFor(d time.Duration) int {
+	t := int(math.Round(float64(d) / float64(g.stepDuration())))
+	if t < 1 {
+		return 1
+	}
+	return t
+}
+
+// advanceClocks accumulates one tick's worth of scaled time for the game and
+// for each TimeScaler, and works out how many simulation steps each should
+// run. It returns the largest number of steps.
+func (g *Game) advanceClocks() int {
+	ratio := float64(tickDuration()) / float64(g.stepDuration())
+	oldAcc := g.clockAcc
+	g.clockAcc = make(map[any]float64)
+	g.clockSteps = make(map[any]int)
+
+	advance := func(domain any, scale float64) int {
+		acc := oldAcc[domain] + ratio*scale
+		n := int(acc)
+		g.clockAcc[domain] = acc - float64(n)
+		g.clockSteps[domain] = n
+		return n
+	}
+
+	maxSteps := advance(g, g.TimeScale())
+	scales := []float64{g.TimeScale()}
+	g.Query(g.Root, TimeScalerType,
+		func(c any) error {
+			if d, ok := c.(Disabler); ok && d.Disabled() {
+				// Disabled subtrees don't accumulate time.
+				return Skip
+			}
+			ts, ok := c.(TimeScaler)
+			if !ok {
+				return nil
+			}
+			s := scales[len(scales)-1] * math.Max(ts.TimeScale(), 0)
+			scales = append(scales, s)
+			if n := advance(c, s); n > maxSteps {
+				maxSteps = n
+			}
+			return nil
+		},
+		func(c any) error {
+			if _, ok := c.(TimeScaler); ok {
+				scales = scales[:len(scales)-1]
+			}
+			return nil
+		},
+	)
+	return maxSteps
+}
+
+// TimeWarp is a component that scales the passage of time for its
+// descendants, relative to its ancestors. A zero Factor is treated as 1, so
+// the zero TimeWarp has no effect. To freeze a subtree, disable it instead.
+type TimeWarp struct {
+	Child  any
+	Factor float64 // 1 (or 0) = normal speed, 0.5 = half speed
+}
+
+// Scan visits w.Child.
+func (w *TimeWarp) Scan(visit VisitFunc) error {
+	return visit(w.Child)
+}
+
+func (w *TimeWarp) String() string { return "TimeWarp" }
+
+// TimeScale returns w.Factor, or 1 if w.Factor is 0.
+func (w *TimeWarp) TimeScale() float64 {
+	if w.Factor == 0 {
+		return 1
+	}
+	return w.Factor
+}
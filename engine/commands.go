@@ -0,0 +1,75 @@
+/*
+Copyright 2022 Josh Deprez
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+// Defer queues fn to be called at the end of the current (or next) call to
+// Update, after all components have been updated. Structural changes to the
+// game tree (registering and unregistering components) made during Update or
+// Draw should be deferred, so that they don't happen while the component
+// database is being walked.
+//
+// Deferred functions are called in the order they were queued. Functions
+// deferred by a deferred function are called in the next Update (so that a
+// function that defers itself every frame doesn't stall Update). The first
+// error returned by a deferred function is returned from Update.
+// Defer is safe to call from multiple goroutines.
+func (g *Game) Defer(fn func() error) {
+	g.cmdmu.Lock()
+	g.cmds = append(g.cmds, fn)
+	g.cmdmu.Unlock()
+}
+
+// Spawn defers loading (using the assets given to LoadAndPrepare),
+// registering (with PathRegister), and preparing a component as a child of
+// parent.
+func (g *Game) Spawn(component, parent any) {
+	g.Defer(func() error {
+		if err := g.Load(component, g.assets); err != nil {
+			return err
+		}
+		if err := g.PathRegister(component, parent); err != nil {
+			return err
+		}
+		return g.Prepare(component)
+	})
+}
+
+// Despawn defers unregistering a component (with PathUnregister).
+func (g *Game) Despawn(component any) {
+	g.Defer(func() error {
+		g.PathUnregister(component)
+		return nil
+	})
+}
+
+// runDeferred calls the functions that were deferred before it was called,
+// and returns the first error. Functions deferred while it runs are left for
+// the next call.
+func (g *Game) runDeferred() error {
+	g.cmdmu.Lock()
+	cmds := g.cmds
+	g.cmds = nil
+	g.cmdmu.Unlock()
+
+	var firstErr error
+	for _, fn := range cmds {
+		if err := fn(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -29,7 +29,7 @@ var _ interface {
 } = &Container{}
 
 func init() {
-	gob.Register(&Container{})
+	RegisterType(&Container{})
 }
 
 // Container is a component that contains many other components, in order.
@@ -17,7 +17,6 @@ limitations under the License.
 package engine
 
 import (
-	"encoding/gob"
 	"fmt"
 	"image"
 
@@ -39,8 +38,8 @@ var (
 )
 
 func init() {
-	gob.Register(&DebugToast{})
-	gob.Register(&PerfDisplay{})
+	RegisterType(&DebugToast{})
+	RegisterType(&PerfDisplay{})
 }
 
 // DebugToast debugprints a string for a while, then disappears.
@@ -17,10 +17,9 @@ limitations under the License.
 package engine
 
 import (
-	"encoding/gob"
 	"fmt"
 	"image"
-	"log"
+	"io/fs"
 	"math"
 	"strings"
 
@@ -32,14 +31,15 @@ var _ interface {
 	Drawer
 	DrawManager
 	Hider
+	PreDrawUpdater
 	Prepper
 	Registrar
 	Scanner
-	Updater
+	Validator
 } = &DrawDAG{}
 
 func init() {
-	gob.Register(&DrawDAG{})
+	RegisterType(&DrawDAG{})
 }
 
 // DrawDAG is a DrawManager that organises DrawBoxer descendants in a directed
@@ -78,7 +78,7 @@ func (d *DrawDAG) Draw(screen *ebiten.Image, opts *ebiten.DrawImageOptions) {
 		},
 	}
 	// Draw everything in d.dag, where not hidden (itself or any parent)
-	d.dag.topWalk(func(x Drawer) {
+	d.dag.topWalk(d.logCycle, func(x Drawer) {
 		// Is d hidden itself?
 		if h, ok := x.(Hider); ok && h.Hidden() {
 			cache[x] = state{hidden: true}
@@ -143,14 +143,13 @@ func (d *DrawDAG) Scan(visit VisitFunc) error {
 
 func (d *DrawDAG) String() string { return "DrawDAG" }
 
-// Update checks for any changes to descendants, and updates its internal
-// data structures accordingly.
-func (d *DrawDAG) Update() error {
+// UpdatePreDraw checks for any changes to descendants, and updates its
+// internal data structures accordingly.
+func (d *DrawDAG) UpdatePreDraw() error {
 	// Re-evaluate bounding boxes for all descendants. If a box has changed,
 	// fix up the edges by removing and re-adding the vertex.
-	// Thanks once again to postorder traversal in Game.Update, this happens
-	// after all descendant updates.
-	// TODO: more flexible update ordering system...
+	// Because this happens in PhasePreDraw, all descendants have finished
+	// moving for this update.
 	var readd []DrawBoxer
 	for db, bb := range d.boxCache {
 		nbb := db.BoundingBox()
@@ -165,6 +164,14 @@ func (d *DrawDAG) Update() error {
 	return nil
 }
 
+// Validate checks that ChunkSize is positive.
+func (d *DrawDAG) Validate(*Game, fs.FS) error {
+	if d.ChunkSize <= 0 {
+		return fmt.Errorf("ChunkSize = %d, must be positive", d.ChunkSize)
+	}
+	return nil
+}
+
 // Register recursively registers compponent and all descendants that are
 // DrawBoxers into internal data structures (the DAG, etc) unless they are
 // descendants of a different DrawManager.
@@ -370,10 +377,15 @@ func (d dag) removeEdge(u, v Drawer) {
 	delete(d[u].out, v)
 }
 
+// logCycle logs (at debug level) that a cycle is being broken.
+func (d *DrawDAG) logCycle(v Drawer, indegree int) {
+	d.game.Log(LevelDebug, "breaking cycle in DAG", F("vertex", v), F("indegree", indegree))
+}
+
 // topWalk visits each vertex in topological order, in time O(|V| + |E|) and
 // O(|V|) temporary memory (for acyclic graphs) and a bit longer if it has to
-// break cycles.
-func (d dag) topWalk(visit func(Drawer)) {
+// break cycles. If cycle is not nil, it is called each time a cycle is broken.
+func (d dag) topWalk(cycle func(v Drawer, indegree int), visit func(Drawer)) {
 	// Count indegrees - indegree(v) = len(d[v].in) for each vertex v.
 	// If indegree(v) = 0, enqueue. Total: O(|V|).
 	queue := make([]Drawer, 0, len(d))
@@ -397,7 +409,9 @@ func (d dag) topWalk(visit func(Drawer)) {
 					mind, minv = d, v
 				}
 			}
-			log.Printf("breaking cycle in 'DAG' by enqueueing %v with indegree %d", minv, mind)
+			if cycle != nil {
+				cycle(minv, mind)
+			}
 			queue = append(queue, minv)
 			delete(indegree, minv)
 		}
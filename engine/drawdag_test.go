@@ -166,7 +166,7 @@ func TestTopWalk(t *testing.T) {
 	}
 
 	var got []Drawer
-	d.topWalk(func(x Drawer) {
+	d.topWalk(nil, func(x Drawer) {
 		got = append(got, x)
 	})
 	want := []Drawer{u, v, w}
@@ -194,7 +194,7 @@ func TestTopWalkToleratesCycle(t *testing.T) {
 		},
 	}
 	got := make(map[Drawer]int)
-	d.topWalk(func(x Drawer) {
+	d.topWalk(nil, func(x Drawer) {
 		got[x]++
 	})
 	want := map[Drawer]int{u: 1, v: 1, w: 1}
@@ -16,11 +16,7 @@ limitations under the License.
 
 package engine
 
-import (
-	"encoding/gob"
-
-	"github.com/hajimehoshi/ebiten/v2"
-)
+import "github.com/hajimehoshi/ebiten/v2"
 
 var _ interface {
 	Drawer
@@ -29,7 +25,7 @@ var _ interface {
 } = &DrawDFS{}
 
 func init() {
-	gob.Register(&DrawDFS{})
+	RegisterType(&DrawDFS{})
 }
 
 // DrawDFS is a DrawManager that does not add any structure. Components are
@@ -46,8 +42,15 @@ type DrawDFS struct {
 // Draw draws all descendant components (that are not managed by some other
 // DrawManager) in a pre-order traversal.
 func (d *DrawDFS) Draw(screen *ebiten.Image, opts *ebiten.DrawImageOptions) {
+	drawSubtree(d.game, d, screen, opts)
+}
+
+// drawSubtree draws root's descendants (but not root itself) in a pre-order
+// traversal, skipping hidden components and the subtrees of DrawManagers
+// (which draw themselves). Transformers (including root) are applied.
+func drawSubtree(g *Game, root any, screen *ebiten.Image, opts *ebiten.DrawImageOptions) {
 	stack := []ebiten.DrawImageOptions{*opts}
-	d.game.Query(d, DrawerType,
+	g.Query(root, DrawerType,
 		// visitPre
 		func(x any) error {
 			if h, ok := x.(Hider); ok && h.Hidden() {
@@ -58,7 +61,7 @@ func (d *DrawDFS) Draw(screen *ebiten.Image, opts *ebiten.DrawImageOptions) {
 				opts = concatOpts(tf.Transform(), opts)
 				stack = append(stack, opts)
 			}
-			if x == d { // neither draw nor skip d itself
+			if x == root { // neither draw nor skip root itself
 				return nil
 			}
 			if dr, ok := x.(Drawer); ok {
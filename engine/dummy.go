@@ -17,10 +17,17 @@ limitations under the License.
 package engine
 
 import (
+	"context"
 	"io/fs"
 	"time"
 )
 
+// Ensure DummyLoad satisfies interfaces.
+var _ interface {
+	ContextLoader
+	Loader
+} = DummyLoad{}
+
 // DummyLoad is a loader that just takes up time and doesn't actually load
 // anything.
 type DummyLoad struct {
@@ -28,7 +35,19 @@ type DummyLoad struct {
 }
 
 // Load sleeps for d.Duration, then returns nil.
-func (d DummyLoad) Load(fs.FS) error {
-	time.Sleep(d.Duration)
-	return nil
+func (d DummyLoad) Load(assets fs.FS) error {
+	return d.LoadContext(context.Background(), assets)
+}
+
+// LoadContext sleeps for d.Duration, then returns nil. If ctx is cancelled
+// before then, it returns ctx.Err() early.
+func (d DummyLoad) LoadContext(ctx context.Context, _ fs.FS) error {
+	t := time.NewTimer(d.Duration)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
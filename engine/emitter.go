@@ -0,0 +1,226 @@
+/*
+Copyright 2021 Josh Deprez
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import (
+	"fmt"
+	"image"
+	"io/fs"
+	"math"
+
+	"github.com/DrJosh9000/ichigo/geom"
+)
+
+// Ensure SoundEmitter satisfies interfaces.
+var _ interface {
+	Disposer
+	Identifier
+	PreDrawUpdater
+	Prepper
+	Scanner
+	Validator
+} = &SoundEmitter{}
+
+func init() {
+	RegisterType(&SoundEmitter{})
+	RegisterType(&geom.LinearSpline{})
+	RegisterType(&geom.CubicSpline{})
+}
+
+// Curve is a function of one variable, such as *geom.LinearSpline or
+// *geom.CubicSpline.
+type Curve interface {
+	Prepare() error
+	Interpolate(x float64) float64
+}
+
+// SoundEmitter plays a sound from a position in the world, so that it is
+// panned and attenuated according to where it is relative to a camera. Attach
+// it to a Sprite or Billboard (in Sounds), and it uses the parent's position
+// (plus Offset). Under other parents that are BoundingBoxers, it uses the
+// centre of the bounding box.
+//
+// Distances are measured on screen: the position is projected with
+// Game.Projection, then compared with the camera's Centre, taking into
+// account its Zoom and Rotation.
+type SoundEmitter struct {
+	ID
+	CameraID string    // camera to listen from; default is the nearest Camera ancestor
+	Offset   geom.Int3 // added to the parent's position
+	Sound    SoundRef
+
+	// Falloff maps the distance from the centre of the screen (in pixels) to
+	// gain. The default falls off linearly from 1 at the centre to 0 at a
+	// distance equal to the screen width.
+	Falloff Curve
+
+	// Panning maps the horizontal offset from the centre of the screen (in
+	// pixels) to pan. The default pans linearly from -1 (left) at the left
+	// edge of the screen to 1 (right) at the right edge.
+	Panning Curve
+
+	game   *Game
+	camera *Camera
+	voices []*Voice
+}
+
+// Play plays the sound at the emitter's current position. The sound follows
+// the emitter while it plays.
+func (e *SoundEmitter) Play() *Voice {
+	v := e.Sound.Play()
+	if v == nil {
+		return nil
+	}
+	v.SetSpatial(e.GainPan())
+	live := e.voices[:0]
+	for _, old := range e.voices {
+		if old.Playing() {
+			live = append(live, old)
+		}
+	}
+	e.voices = append(live, v)
+	return v
+}
+
+// Prepare finds the camera and prepares the curves.
+func (e *SoundEmitter) Prepare(game *Game) error {
+	e.game = game
+	cam, err := e.findCamera(game)
+	if err != nil {
+		return err
+	}
+	e.camera = cam
+	for _, c := range []Curve{e.Falloff, e.Panning} {
+		if c == nil {
+			continue
+		}
+		if err := c.Prepare(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Validate checks that there is a camera.
+func (e *SoundEmitter) Validate(game *Game, _ fs.FS) error {
+	_, err := e.findCamera(game)
+	return err
+}
+
+func (e *SoundEmitter) findCamera(game *Game) (*Camera, error) {
+	if e.CameraID != "" {
+		c, ok := game.LookupFrom(e, e.CameraID).(*Camera)
+		if !ok {
+			return nil, fmt.Errorf("component %q type != *Camera", e.CameraID)
+		}
+		return c, nil
+	}
+	for _, c := range game.ReversePath(e) {
+		if cam, ok := c.(*Camera); ok {
+			return cam, nil
+		}
+	}
+	return nil, fmt.Errorf("no Camera ancestor and CameraID not set")
+}
+
+// Scan visits &e.Sound.
+func (e *SoundEmitter) Scan(visit VisitFunc) error {
+	return visit(&e.Sound)
+}
+
+// UpdatePreDraw updates the gain and pan of playing sounds, once everything
+// (including the camera) has moved.
+func (e *SoundEmitter) UpdatePreDraw() error {
+	if len(e.voices) == 0 {
+		return nil
+	}
+	gain, pan := e.GainPan()
+	live := e.voices[:0]
+	for _, v := range e.voices {
+		if v.Playing() {
+			v.SetSpatial(gain, pan)
+			live = append(live, v)
+		}
+	}
+	for i := len(live); i < len(e.voices); i++ {
+		e.voices[i] = nil
+	}
+	e.voices = live
+	return nil
+}
+
+// Dispose stops the sound.
+func (e *SoundEmitter) Dispose() {
+	e.Sound.Stop()
+	e.voices = nil
+}
+
+// Pos returns the position of the emitter in world coordinates.
+func (e *SoundEmitter) Pos() geom.Int3 {
+	var pos geom.Int3
+	switch p := e.game.Parent(e).(type) {
+	case *Sprite:
+		pos = p.Actor.Pos
+	case *Billboard:
+		pos = p.Pos
+	case BoundingBoxer:
+		pos = p.BoundingBox().Centre()
+	}
+	return pos.Add(e.Offset)
+}
+
+// GainPan returns the gain and pan for a sound at the emitter's position. If
+// the emitter has no camera (e.g. it is not prepared), it returns 1, 0.
+func (e *SoundEmitter) GainPan() (gain, pan float64) {
+	if e.game == nil || e.camera == nil {
+		return 1, 0
+	}
+	return spatialize(e.game.Projection, e.Pos(), e.camera, e.game.ScreenSize, e.Falloff, e.Panning)
+}
+
+// spatialize computes the gain and pan for a sound at pos, heard by cam.
+// Nil curves use the defaults described on SoundEmitter.
+func spatialize(π geom.Projector, pos geom.Int3, cam *Camera, screen image.Point, falloff, panning Curve) (gain, pan float64) {
+	p := geom.Project(π, pos)
+	dx, dy := geom.CFloat(p.Sub(cam.Centre))
+	if cam.Zoom != 0 {
+		dx, dy = dx*cam.Zoom, dy*cam.Zoom
+	}
+	if cam.Rotation != 0 {
+		sin, cos := math.Sincos(cam.Rotation)
+		dx, dy = dx*cos-dy*sin, dx*sin+dy*cos
+	}
+	dist := math.Hypot(dx, dy)
+
+	switch {
+	case falloff != nil:
+		gain = falloff.Interpolate(dist)
+	case screen.X > 0:
+		gain = 1 - dist/float64(screen.X)
+	default:
+		gain = 1
+	}
+	switch {
+	case panning != nil:
+		pan = panning.Interpolate(dx)
+	case screen.X > 0:
+		pan = dx / (float64(screen.X) / 2)
+	}
+	return math.Max(0, math.Min(gain, 1)), math.Max(-1, math.Min(pan, 1))
+}
+
+func (e *SoundEmitter) String() string { return "SoundEmitter{" + e.Sound.Path + "}" }
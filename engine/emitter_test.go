@@ -0,0 +1,125 @@
+/*
+Copyright 2021 Josh Deprez
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import (
+	"encoding/binary"
+	"image"
+	"math"
+	"testing"
+	"testing/fstest"
+
+	"github.com/DrJosh9000/ichigo/geom"
+)
+
+func TestSpatialize(t *testing.T) {
+	screen := image.Pt(320, 240)
+	tests := []struct {
+		name      string
+		pos       geom.Int3
+		cam       Camera
+		falloff   Curve
+		gain, pan float64
+	}{
+		{name: "centre", pos: geom.Pt3(10, 20, 0), cam: Camera{Centre: image.Pt(10, 20), Zoom: 1}, gain: 1},
+		{name: "right edge", pos: geom.Pt3(160, 0, 0), cam: Camera{Zoom: 1}, gain: 0.5, pan: 1},
+		{name: "left", pos: geom.Pt3(-80, 0, 0), cam: Camera{Zoom: 1}, gain: 0.75, pan: -0.5},
+		{name: "below", pos: geom.Pt3(0, 80, 0), cam: Camera{Zoom: 1}, gain: 0.75},
+		{name: "far away", pos: geom.Pt3(1000, 0, 0), cam: Camera{Zoom: 1}, gain: 0, pan: 1},
+		{name: "zoomed", pos: geom.Pt3(80, 0, 0), cam: Camera{Zoom: 2}, gain: 0.5, pan: 1},
+		{name: "rotated", pos: geom.Pt3(80, 0, 0), cam: Camera{Zoom: 1, Rotation: math.Pi}, gain: 0.75, pan: -0.5},
+		{
+			name:    "falloff curve",
+			pos:     geom.Pt3(50, 0, 0),
+			cam:     Camera{Zoom: 1},
+			falloff: &geom.LinearSpline{Points: []geom.Float2{{X: 0, Y: 1}, {X: 100, Y: 0.2}}},
+			gain:    0.6,
+			pan:     0.3125,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.falloff != nil {
+				if err := test.falloff.Prepare(); err != nil {
+					t.Fatalf("falloff.Prepare() = %v", err)
+				}
+			}
+			gain, pan := spatialize(geom.ElevationProjection{}, test.pos, &test.cam, screen, test.falloff, nil)
+			if math.Abs(gain-test.gain) > 1e-9 || math.Abs(pan-test.pan) > 1e-9 {
+				t.Errorf("spatialize() = (%v, %v), want (%v, %v)", gain, pan, test.gain, test.pan)
+			}
+		})
+	}
+}
+
+// boxParent is a BoundingBoxer with a SoundEmitter beneath it.
+type boxParent struct {
+	box geom.Box
+	e   *SoundEmitter
+}
+
+func (p *boxParent) BoundingBox() geom.Box      { return p.box }
+func (p *boxParent) Scan(visit VisitFunc) error { return visit(p.e) }
+
+func TestSoundEmitterFollowsParent(t *testing.T) {
+	assets := fstest.MapFS{
+		"beep.wav": {Data: testWAV(constClip(100, 1000).Samples)},
+	}
+	e := &SoundEmitter{Sound: SoundRef{Path: "beep.wav"}}
+	parent := &boxParent{box: geom.Box{Min: geom.Pt3(-1, -1, -1), Max: geom.Pt3(1, 1, 1)}, e: e}
+	g := &Game{
+		Projection: geom.ElevationProjection{},
+		ScreenSize: image.Pt(320, 240),
+		Root: &DrawDFS{Child: &Camera{
+			ID:    "cam",
+			Zoom:  1,
+			Child: parent,
+		}},
+	}
+	if err := g.LoadAndPrepare(assets); err != nil {
+		t.Fatalf("LoadAndPrepare() = %v", err)
+	}
+	if err := g.Validate(assets); err != nil {
+		t.Errorf("Validate() = %v", err)
+	}
+
+	// stereo reads one frame and returns the left and right samples.
+	stereo := func() (l, r int16) {
+		p := make([]byte, 4)
+		g.Mixer().Read(p)
+		return int16(binary.LittleEndian.Uint16(p)), int16(binary.LittleEndian.Uint16(p[2:]))
+	}
+
+	e.Play()
+	if l, r := stereo(); l != 1000 || r != 1000 {
+		t.Errorf("at centre: stereo() = %d, %d, want 1000, 1000", l, r)
+	}
+
+	// Move to the right edge of the screen.
+	parent.box = parent.box.Add(geom.Pt3(160, 0, 0))
+	if err := e.UpdatePreDraw(); err != nil {
+		t.Fatalf("UpdatePreDraw() = %v", err)
+	}
+	if l, r := stereo(); l != 0 || r != 500 {
+		t.Errorf("at right edge: stereo() = %d, %d, want 0, 500", l, r)
+	}
+
+	e.Dispose()
+	if l, r := stereo(); l != 0 || r != 0 {
+		t.Errorf("after Dispose: stereo() = %d, %d, want 0, 0", l, r)
+	}
+}
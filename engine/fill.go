@@ -17,7 +17,6 @@ limitations under the License.
 package engine
 
 import (
-	"encoding/gob"
 	"image/color"
 
 	"github.com/hajimehoshi/ebiten/v2"
@@ -31,9 +30,9 @@ var _ interface {
 } = &Fill{}
 
 func init() {
-	gob.Register(&Fill{})
-	gob.Register(color.Gray{})
-	gob.Register(color.RGBA{})
+	RegisterType(&Fill{})
+	RegisterType(color.Gray{})
+	RegisterType(color.RGBA{})
 }
 
 // Fill fills the screen with a colour.
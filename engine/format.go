@@ -0,0 +1,159 @@
+/*
+Copyright 2021 Josh Deprez
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"runtime/debug"
+	"sync"
+)
+
+// gobzMagic begins the (decompressed) contents of versioned gobz files. No
+// gob stream can begin with a zero byte, so files without the magic are
+// treated as legacy (format version 0) files containing only a gob payload.
+const gobzMagic = "\x00ichigo"
+
+// gobzEnvelope is gob-encoded after gobzMagic.
+type gobzEnvelope struct {
+	FormatVersion int
+	EngineVersion string
+	Payload       []byte // gob encoding of the saved value
+}
+
+// Migration upgrades the gob payload of a file from one format version to the
+// next. Typically a migration decodes the payload into types matching the old
+// shape of the data, converts it, and encodes the result.
+type Migration func(payload []byte) ([]byte, error)
+
+var (
+	migrationsMu sync.RWMutex
+	migrations   []Migration // migrations[v] upgrades version v to v+1
+)
+
+// RegisterMigration registers a migration from format version from to from+1.
+// Migrations must be registered in order, starting at 0 (legacy files with
+// no version header), and the current format version is the number of
+// migrations registered. Like gob.Register, it is intended to be called from
+// init functions, and panics if registered out of order.
+func RegisterMigration(from int, m Migration) {
+	migrationsMu.Lock()
+	defer migrationsMu.Unlock()
+	if from != len(migrations) {
+		panic(fmt.Sprintf("RegisterMigration(%d, ...): next migration must be from version %d", from, len(migrations)))
+	}
+	migrations = append(migrations, m)
+}
+
+// FormatVersion returns the current format version, which is written by
+// SaveGobz. Files with older versions are migrated when loaded by LoadGobz.
+func FormatVersion() int {
+	migrationsMu.RLock()
+	defer migrationsMu.RUnlock()
+	return len(migrations)
+}
+
+// FormatVersionError is returned by LoadGobz for files saved with a newer
+// format version than this program supports.
+type FormatVersionError struct {
+	Path          string
+	Version       int    // format version of the file
+	Supported     int    // latest format version supported
+	EngineVersion string // engine version that saved the file
+}
+
+func (e *FormatVersionError) Error() string {
+	return fmt.Sprintf("%s: format version %d (saved by engine %s) is newer than the latest supported version %d; upgrade to load it", e.Path, e.Version, e.EngineVersion, e.Supported)
+}
+
+// encodeVersioned wraps a gob payload in the current versioned envelope.
+func encodeVersioned(payload []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(gobzMagic)
+	env := gobzEnvelope{
+		FormatVersion: FormatVersion(),
+		EngineVersion: engineVersion(),
+		Payload:       payload,
+	}
+	if err := gob.NewEncoder(&buf).Encode(env); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeVersioned unwraps the envelope (if any) from data, and migrates the
+// payload up to the current format version.
+func decodeVersioned(path string, data []byte) ([]byte, error) {
+	env := gobzEnvelope{Payload: data} // legacy: version 0, no envelope
+	if bytes.HasPrefix(data, []byte(gobzMagic)) {
+		env = gobzEnvelope{}
+		r := bytes.NewReader(data[len(gobzMagic):])
+		if err := gob.NewDecoder(r).Decode(&env); err != nil {
+			return nil, fmt.Errorf("%s: decoding header: %w", path, err)
+		}
+	}
+
+	migrationsMu.RLock()
+	defer migrationsMu.RUnlock()
+	if env.FormatVersion > len(migrations) {
+		return nil, &FormatVersionError{
+			Path:          path,
+			Version:       env.FormatVersion,
+			Supported:     len(migrations),
+			EngineVersion: env.EngineVersion,
+		}
+	}
+	payload := env.Payload
+	for v := env.FormatVersion; v < len(migrations); v++ {
+		p, err := migrations[v](payload)
+		if err != nil {
+			return nil, fmt.Errorf("%s: migrating from format version %d: %w", path, v, err)
+		}
+		payload = p
+	}
+	return payload, nil
+}
+
+var (
+	engineVersionOnce sync.Once
+	engineVersionStr  string
+)
+
+// engineVersion returns the version of the engine module, from the build
+// info, or "(unknown)".
+func engineVersion() string {
+	engineVersionOnce.Do(func() {
+		engineVersionStr = "(unknown)"
+		bi, ok := debug.ReadBuildInfo()
+		if !ok {
+			return
+		}
+		const mod = "github.com/DrJosh9000/ichigo"
+		if bi.Main.Path == mod {
+			engineVersionStr = bi.Main.Version
+			return
+		}
+		for _, d := range bi.Deps {
+			if d.Path == mod {
+				engineVersionStr = d.Version
+				return
+			}
+		}
+	})
+	return engineVersionStr
+}
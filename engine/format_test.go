@@ -0,0 +1,108 @@
+/*
+Copyright 2021 Josh Deprez
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"testing"
+	"testing/fstest"
+)
+
+// withMigrations replaces the registered migrations for the duration of a
+// test.
+func withMigrations(t *testing.T, ms ...Migration) {
+	t.Helper()
+	migrationsMu.Lock()
+	old := migrations
+	migrations = nil
+	migrationsMu.Unlock()
+	t.Cleanup(func() {
+		migrationsMu.Lock()
+		migrations = old
+		migrationsMu.Unlock()
+	})
+	for i, m := range ms {
+		RegisterMigration(i, m)
+	}
+}
+
+type oldLevel struct{ Name string }
+type newLevel struct{ Title string }
+
+func TestLoadGobzLegacyWithMigration(t *testing.T) {
+	withMigrations(t, func(payload []byte) ([]byte, error) {
+		var o oldLevel
+		if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&o); err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		err := gob.NewEncoder(&buf).Encode(newLevel{Title: o.Name})
+		return buf.Bytes(), err
+	})
+	assets := fstest.MapFS{
+		"legacy.gobz": {Data: gobz(t, oldLevel{Name: "level 1"})},
+	}
+	var got newLevel
+	if err := LoadGobz(&got, assets, "legacy.gobz"); err != nil {
+		t.Fatalf("LoadGobz(legacy) = %v, want nil", err)
+	}
+	if want := (newLevel{Title: "level 1"}); got != want {
+		t.Errorf("LoadGobz(legacy) loaded %+v, want %+v", got, want)
+	}
+}
+
+func TestSaveGobzRoundTripCurrentVersion(t *testing.T) {
+	migrated := false
+	withMigrations(t, func(payload []byte) ([]byte, error) {
+		migrated = true
+		return payload, nil
+	})
+	var fs MemFS
+	if err := SaveGobz(newLevel{Title: "x"}, &fs, "a.gobz"); err != nil {
+		t.Fatalf("SaveGobz() = %v, want nil", err)
+	}
+	var got newLevel
+	if err := LoadGobz(&got, &fs, "a.gobz"); err != nil {
+		t.Fatalf("LoadGobz() = %v, want nil", err)
+	}
+	if got.Title != "x" {
+		t.Errorf("LoadGobz() loaded %+v, want Title x", got)
+	}
+	if migrated {
+		t.Error("migration ran on a file saved at the current version")
+	}
+}
+
+func TestLoadGobzTooNew(t *testing.T) {
+	withMigrations(t, func(payload []byte) ([]byte, error) { return payload, nil })
+	var fs MemFS
+	if err := SaveGobz(newLevel{Title: "x"}, &fs, "a.gobz"); err != nil {
+		t.Fatalf("SaveGobz() = %v, want nil", err)
+	}
+	withMigrations(t) // now the file is one version too new
+
+	var fve *FormatVersionError
+	err := LoadGobz(new(newLevel), &fs, "a.gobz")
+	if !errors.As(err, &fve) {
+		t.Fatalf("LoadGobz() = %v, want *FormatVersionError", err)
+	}
+	if fve.Version != 1 || fve.Supported != 0 {
+		t.Errorf("FormatVersionError = %+v, want Version 1, Supported 0", fve)
+	}
+}
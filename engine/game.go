@@ -17,13 +17,12 @@ limitations under the License.
 package engine
 
 import (
-	"encoding/gob"
 	"errors"
 	"fmt"
 	"image"
 	"io/fs"
-	"log"
 	"reflect"
+	"strings"
 	"sync"
 	"time"
 
@@ -46,7 +45,7 @@ var (
 )
 
 func init() {
-	gob.Register(&Game{})
+	RegisterType(&Game{})
 }
 
 // Game implements the ebiten methods using a collection of components. One
@@ -57,13 +56,47 @@ type Game struct {
 	Projection geom.Projector
 	Root       Drawer
 	ScreenSize image.Point
+	Step       time.Duration // simulated time per step; default is 1/MaxTPS
 	VoxelScale geom.Float3
 
-	dbmu     sync.RWMutex
-	byID     map[string]Identifier  // Named components by ID
-	byAB     map[abKey]*Container   // paths matching interface
-	parent   map[any]any 	        // parent[x] is parent of x
-	children map[any]*Container     // children[x] are children of x
+	// LoadWorkers is the maximum number of Loaders that Load and LoadContext
+	// run concurrently. 0 or 1 means loading happens serially.
+	LoadWorkers int
+
+	dbmu       sync.RWMutex
+	byID       map[string]*Container         // Named components by ID, in any scope
+	scopes     map[any]map[string]Identifier // scopes[s][id] is in scope s
+	byAB       map[abKey]*Container          // paths matching interface
+	parent     map[any]any                   // parent[x] is parent of x
+	children   map[any]*Container            // children[x] are children of x
+	behaviours []reflect.Type                // extra behaviours from RegisterBehaviour
+	hooks      []func()                      // Registered/Dispose calls pending unlock
+
+	assets fs.FS          // from LoadAndPrepare, used by Spawn
+	cmdmu  sync.Mutex     // guards cmds
+	cmds   []func() error // queued by Defer
+
+	tick         uint64          // see Tick
+	timeScale    float64         // see TimeScale
+	timeScaleSet bool            // false means timeScale = 1
+	clockAcc     map[any]float64 // fractional steps, by time domain
+	clockSteps   map[any]int     // steps to run this tick, by time domain
+
+	timermu       sync.Mutex       // guards timers and timersByOwner
+	timers        []*Timer         // in order of scheduling
+	timersByOwner map[any][]*Timer // for cancelling on unregister
+
+	cacheOnce  sync.Once     // creates assetCache
+	assetCache *AssetCache   // see AssetCache
+	sinceSweep time.Duration // real time since Update last swept assetCache
+
+	audiomu  sync.Mutex  // guards mixer and audioOut
+	mixer    *Mixer      // see Mixer
+	audioOut audioOutput // reads from mixer
+
+	logmu     sync.RWMutex // guards logger and loadStats
+	logger    Logger       // see Logger
+	loadStats LoadStats    // see LoadStats
 }
 
 // Draw draws everything.
@@ -79,37 +112,57 @@ func (g *Game) Layout(outsideWidth, outsideHeight int) (w, h int) {
 	return g.ScreenSize.X, g.ScreenSize.Y
 }
 
-// Update updates everything. Subcomponents are updated before parent
-// components. Disabled components, and components with a disabled ancestor, are
-// not updated.
+// Update updates everything, by running each Phase in order across the
+// whole game tree. PhaseInput runs once per call, since input only changes
+// once per frame. The other phases run once for each fixed-size simulation
+// step that is due, taking into account Step, the global time scale, and any
+// TimeScalers (so they may run zero times, or several). Within each phase,
+// subcomponents are updated before parent components. Disabled components,
+// and components with a disabled ancestor, are not updated. Once everything
+// is updated, functions queued with Defer are called.
 func (g *Game) Update() error {
-	return g.Query(g.Root, UpdaterType,
-		func(c any) error {
-			if d, ok := c.(Disabler); ok && d.Disabled() {
-				// Do not update this component or descendants.
-				return Skip
-			}
-			return nil
-		},
-		func(c any) error {
-			if u, ok := c.(Updater); ok {
-				return u.Update()
+	steps := g.advanceClocks()
+	if err := g.updatePhase(PhaseInput, 0); err != nil {
+		return err
+	}
+	for i := 0; i < steps; i++ {
+		for p := PhaseInput + 1; p < numPhases; p++ {
+			if err := g.updatePhase(p, i); err != nil {
+				return err
 			}
-			return nil
-		},
-	)
+		}
+		g.runTimers(i)
+		if i < g.clockSteps[g] {
+			g.tick++
+		}
+	}
+	g.updateAudio()
+	err := g.runDeferred()
+	g.sweepAssets()
+	return err
 }
 
 // Ident returns "__GAME__".
 func (g *Game) Ident() string { return "__GAME__" }
 
 // Component returns the component with a given ID, or nil if there is none.
+// IDs are only unique within a scope (see Scoper), so if multiple components
+// have the ID, the one registered earliest is returned. If id contains a "/",
+// it is treated as a path (see Lookup).
 // This only returns sensible values for registered components (e.g. after
 // LoadAndPrepare).
 func (g *Game) Component(id string) Identifier {
+	if strings.Contains(id, "/") {
+		return g.Lookup(id)
+	}
 	g.dbmu.RLock()
 	defer g.dbmu.RUnlock()
-	return g.byID[id]
+	var found Identifier
+	g.byID[id].Scan(func(x any) error {
+		found = x.(Identifier)
+		return Skip
+	})
+	return found
 }
 
 // Parent returns the parent of a given component, or nil if there is none.
@@ -173,8 +226,56 @@ func (g *Game) ReversePath(component any) []any {
 	return stack
 }
 
+// RegisterBehaviour adds an interface type to the set of behaviours that can be
+// queried with Query, in addition to those in Behaviours. Components that are
+// already registered are indexed for the new behaviour immediately. Registering
+// a behaviour more than once has no further effect. It is an error to pass a
+// type that is not an interface type.
+func (g *Game) RegisterBehaviour(behaviour reflect.Type) error {
+	if behaviour == nil || behaviour.Kind() != reflect.Interface {
+		return fmt.Errorf("behaviour %v is not an interface type", behaviour)
+	}
+	g.dbmu.Lock()
+	defer g.dbmu.Unlock()
+	for _, b := range g.allBehaviours() {
+		if b == behaviour {
+			return nil
+		}
+	}
+	g.behaviours = append(g.behaviours, behaviour)
+	if g.parent == nil {
+		// Database not built yet; build will index the behaviour.
+		return nil
+	}
+	g.indexRecursive(g, behaviour)
+	return nil
+}
+
+// indexRecursive adds component and its registered descendants into g.byAB
+// for a single behaviour (in pre-order, so that containers match the order
+// produced by registerRecursive).
+func (g *Game) indexRecursive(component any, behaviour reflect.Type) {
+	g.indexOne(component, behaviour)
+	g.children[component].Scan(func(x any) error {
+		g.indexRecursive(x, behaviour)
+		return nil
+	})
+}
+
+// allBehaviours returns Behaviours followed by any behaviours added with
+// RegisterBehaviour. The caller must hold g.dbmu.
+func (g *Game) allBehaviours() []reflect.Type {
+	if len(g.behaviours) == 0 {
+		return Behaviours
+	}
+	all := make([]reflect.Type, 0, len(Behaviours)+len(g.behaviours))
+	all = append(all, Behaviours...)
+	return append(all, g.behaviours...)
+}
+
 // Query recursively searches for components having both a given ancestor and
-// implementing a given behaviour (see Behaviors in interface.go).
+// implementing a given behaviour (see Behaviors in interface.go, and
+// RegisterBehaviour).
 // visitPre is called before descendants are visited, while visitPost is called
 // after descendants are visited. nil visitPre/visitPost are ignored.
 //
@@ -230,24 +331,6 @@ func (g *Game) Scan(visit VisitFunc) error {
 	return visit(g.Root)
 }
 
-// Load loads a component and all subcomponents recursively.
-// Note that this method does not implement Loader itself.
-func (g *Game) Load(component any, assets fs.FS) error {
-	// Query cannot be used for this method because Load might cause
-	// subcomponents to spring into existence.
-	if l, ok := component.(Loader); ok {
-		if err := l.Load(assets); err != nil {
-			return err
-		}
-	}
-	if sc, ok := component.(Scanner); ok {
-		return sc.Scan(func(x any) error {
-			return g.Load(x, assets)
-		})
-	}
-	return nil
-}
-
 // Prepare prepares a component and all subcomponents recursively.
 // Note that this method does not implement Prepper itself.
 func (g *Game) Prepare(component any) error {
@@ -271,38 +354,80 @@ func (g *Game) LoadAndPrepare(assets fs.FS) error {
 	if g.VoxelScale == (geom.Float3{}) {
 		g.VoxelScale = geom.Float3{X: 1, Y: 1, Z: 1}
 	}
+	g.assets = assets
+
+	var stats LoadStats
 
 	// Load all the Loaders.
 	startLoad := time.Now()
 	if err := g.Load(g.Root, assets); err != nil {
 		return err
 	}
-	log.Printf("finished loading in %v", time.Since(startLoad))
+	stats.Load = time.Since(startLoad)
+	g.Log(LevelInfo, "finished loading", F("duration", stats.Load))
 
 	// Build the component databases
 	startBuild := time.Now()
-	if err := g.build(); err != nil {
+	err := g.build()
+	g.runHooks()
+	if err != nil {
 		return err
 	}
-	log.Printf("finished building db in %v", time.Since(startBuild))
+	stats.Build = time.Since(startBuild)
+	g.Log(LevelInfo, "finished building db", F("duration", stats.Build))
 
 	// Prepare all the Preppers
 	startPrep := time.Now()
 	if err := g.Prepare(g.Root); err != nil {
 		return err
 	}
-	log.Printf("finished preparing in %v", time.Since(startPrep))
+	stats.Prepare = time.Since(startPrep)
+	g.Log(LevelInfo, "finished preparing", F("duration", stats.Prepare))
+
+	// Anything in the cache that is no longer used (e.g. from before a
+	// reload) can go.
+	g.AssetCache().Sweep()
+
+	g.logmu.Lock()
+	g.loadStats = stats
+	g.logmu.Unlock()
 	return nil
 }
 
 func (g *Game) build() error {
 	g.dbmu.Lock()
 	defer g.dbmu.Unlock()
-	g.byID = make(map[string]Identifier)
+	prevParent, prevChildren := g.parent, g.children
+	g.byID = make(map[string]*Container)
+	g.scopes = make(map[any]map[string]Identifier)
 	g.byAB = make(map[abKey]*Container)
 	g.parent = make(map[any]any)
 	g.children = make(map[any]*Container)
-	return g.registerRecursive(g, nil)
+	var added []any
+	err := g.registerSubtree(g, nil, &added, prevParent)
+	if prevChildren != nil {
+		// Components that were registered before, but not any more, are
+		// disposed.
+		g.disposeGone(g, prevChildren)
+	}
+	return err
+}
+
+// disposeGone cancels timers for, and queues Dispose for, components in the
+// subtree of an old database (described by children) that are no longer
+// registered. Like unregisterRecursive, it works in post-order.
+func (g *Game) disposeGone(component any, children map[any]*Container) {
+	children[component].Scan(func(x any) error {
+		g.disposeGone(x, children)
+		return nil
+	})
+	if _, ok := g.parent[component]; ok {
+		return
+	}
+	g.cancelTimers(component)
+	if d, ok := component.(Disposer); ok {
+		g.hooks = append(g.hooks, d.Dispose)
+	}
 }
 
 // Register registers a component into the component database (as the
@@ -318,30 +443,69 @@ func (g *Game) Register(component, parent any) error {
 		return errNilParent
 	}
 	g.dbmu.Lock()
-	defer g.dbmu.Unlock()
-	return g.registerRecursive(component, parent)
+	err := g.registerRecursive(component, parent)
+	g.dbmu.Unlock()
+	g.runHooks()
+	return err
 }
 
+// registerRecursive registers component and its subcomponents (found with
+// Scan). If that fails, the components it added are removed again, and no
+// Registered hooks are queued for them.
 func (g *Game) registerRecursive(component, parent any) error {
-	if err := g.registerOne(component, parent); err != nil {
+	nhooks := len(g.hooks)
+	var added []any
+	if err := g.registerSubtree(component, parent, &added, nil); err != nil {
+		for i := len(added) - 1; i >= 0; i-- {
+			g.removeOne(added[i])
+		}
+		g.hooks = g.hooks[:nhooks]
+		return err
+	}
+	return nil
+}
+
+// registerSubtree adds component and its subcomponents into the database,
+// appending each to added, and queues Registered hooks for those that are
+// not keys of prev (which is used when rebuilding the database, and can be
+// nil).
+func (g *Game) registerSubtree(component, parent any, added *[]any, prev map[any]any) error {
+	if err := g.addOne(component, parent); err != nil {
 		return err
 	}
+	*added = append(*added, component)
+	if r, ok := component.(Registeree); ok {
+		if _, was := prev[component]; !was {
+			g.hooks = append(g.hooks, func() { r.Registered(parent) })
+		}
+	}
 	if sc, ok := component.(Scanner); ok {
 		return sc.Scan(func(x any) error {
-			return g.registerRecursive(x, component)
+			return g.registerSubtree(x, component, added, prev)
 		})
 	}
 	return nil
 }
 
-func (g *Game) registerOne(component, parent any) error {
-	// register in g.byID if needed
+// addOne adds a component into the database indexes, without any lifecycle
+// hooks.
+func (g *Game) addOne(component, parent any) error {
+	// register in g.scopes and g.byID if needed
 	if i, ok := component.(Identifier); ok {
 		if id := i.Ident(); id != "" {
-			if _, exists := g.byID[id]; exists {
-				return fmt.Errorf("duplicate id %q", id)
+			scope := g.scopeOf(parent)
+			if _, exists := g.scopes[scope][id]; exists {
+				return fmt.Errorf("duplicate id %q in scope %v", id, scope)
+			}
+			if g.scopes[scope] == nil {
+				g.scopes[scope] = make(map[string]Identifier)
+			}
+			g.scopes[scope][id] = i
+			if g.byID[id] == nil {
+				g.byID[id] = MakeContainer(i)
+			} else {
+				g.byID[id].Add(i)
 			}
-			g.byID[id] = i
 		}
 	}
 
@@ -354,24 +518,29 @@ func (g *Game) registerOne(component, parent any) error {
 	}
 
 	// register in g.byAB
-	ct := reflect.TypeOf(component)
-	for _, b := range Behaviours {
-		if !ct.Implements(b) {
+	for _, b := range g.allBehaviours() {
+		g.indexOne(component, b)
+	}
+	return nil
+}
+
+// indexOne adds the path to component into g.byAB for a single behaviour, if
+// the component implements it.
+func (g *Game) indexOne(component any, behaviour reflect.Type) {
+	if !reflect.TypeOf(component).Implements(behaviour) {
+		return
+	}
+	for c, p := component, g.parent[component]; p != nil; c, p = p, g.parent[p] {
+		k := abKey{p, behaviour}
+		if g.byAB[k] == nil {
+			g.byAB[k] = MakeContainer(c)
 			continue
 		}
-		for c, p := component, g.parent[component]; p != nil; c, p = p, g.parent[p] {
-			k := abKey{p, b}
-			if g.byAB[k] == nil {
-				g.byAB[k] = MakeContainer(c)
-				continue
-			}
-			if g.byAB[k].Contains(c) {
-				break
-			}
-			g.byAB[k].Add(c)
+		if g.byAB[k].Contains(c) {
+			break
 		}
+		g.byAB[k].Add(c)
 	}
-	return nil
 }
 
 // Unregister removes the component from the component database.
@@ -384,22 +553,42 @@ func (g *Game) Unregister(component any) {
 	g.dbmu.Lock()
 	g.unregisterRecursive(component)
 	g.dbmu.Unlock()
+	g.runHooks()
 }
 
 func (g *Game) unregisterRecursive(component any) {
+	// Unregistering children modifies g.children[component], so take a copy
+	// before recursing.
+	var children []any
 	g.children[component].Scan(func(x any) error {
-		g.unregisterRecursive(x)
+		children = append(children, x)
 		return nil
 	})
+	for _, x := range children {
+		g.unregisterRecursive(x)
+	}
 	g.unregisterOne(component)
 }
 
 func (g *Game) unregisterOne(component any) {
+	g.removeOne(component)
+
+	// cancel any timers belonging to the component
+	g.cancelTimers(component)
+
+	if d, ok := component.(Disposer); ok {
+		g.hooks = append(g.hooks, d.Dispose)
+	}
+}
+
+// removeOne removes a component from the database indexes, without any
+// lifecycle hooks.
+func (g *Game) removeOne(component any) {
 	parent := g.parent[component]
 
 	// unregister from g.byAB
 	ct := reflect.TypeOf(component)
-	for _, b := range Behaviours {
+	for _, b := range g.allBehaviours() {
 		if !ct.Implements(b) {
 			continue
 		}
@@ -416,9 +605,32 @@ func (g *Game) unregisterOne(component any) {
 	g.children[parent].Remove(component)
 	delete(g.parent, component)
 
-	// unregister from g.byID if needed
-	if id, ok := component.(Identifier); ok && id.Ident() != "" {
-		delete(g.byID, id.Ident())
+	// unregister from g.scopes and g.byID if needed
+	if i, ok := component.(Identifier); ok {
+		if id := i.Ident(); id != "" {
+			scope := g.scopeOf(parent)
+			if g.scopes[scope][id] == i {
+				delete(g.scopes[scope], id)
+			}
+			g.byID[id].Remove(i)
+			if g.byID[id].ItemCount() == 0 {
+				delete(g.byID, id)
+			}
+		}
+	}
+	delete(g.scopes, component)
+}
+
+// runHooks calls the pending Registered and Dispose hooks, in the order they
+// were queued. It must be called without holding g.dbmu, so that the hooks can
+// use the component database.
+func (g *Game) runHooks() {
+	g.dbmu.Lock()
+	hooks := g.hooks
+	g.hooks = nil
+	g.dbmu.Unlock()
+	for _, h := range hooks {
+		h()
 	}
 }
 
@@ -16,7 +16,14 @@ limitations under the License.
 
 package engine
 
-import "testing"
+import (
+	"errors"
+	"image"
+	"reflect"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
 
 func TestGameLoadAndPrepare(t *testing.T) {
 	g := &Game{
@@ -26,3 +33,556 @@ func TestGameLoadAndPrepare(t *testing.T) {
 		t.Errorf("LoadAndPrepare(nil) = %v, want nil", err)
 	}
 }
+
+type fakeBehaviour interface {
+	fakeBehaviourMethod()
+}
+
+type fakeBehaver struct{}
+
+func (*fakeBehaver) fakeBehaviourMethod() {}
+
+func TestGameRegisterBehaviourAfterRegistration(t *testing.T) {
+	b := &fakeBehaver{}
+	g := &Game{
+		Root: &DrawDFS{Child: MakeContainer(b)},
+	}
+	if err := g.LoadAndPrepare(nil); err != nil {
+		t.Fatalf("LoadAndPrepare(nil) = %v, want nil", err)
+	}
+	bt := reflect.TypeOf((*fakeBehaviour)(nil)).Elem()
+	if err := g.RegisterBehaviour(bt); err != nil {
+		t.Fatalf("RegisterBehaviour(%v) = %v, want nil", bt, err)
+	}
+	var got []any
+	g.Query(g, bt, func(c any) error {
+		if _, ok := c.(fakeBehaviour); ok {
+			got = append(got, c)
+		}
+		return nil
+	}, nil)
+	if want := []any{b}; !cmp.Equal(got, want) {
+		t.Errorf("Query(g, %v) results = %v, want %v", bt, got, want)
+	}
+}
+
+func TestGameRegisterBehaviourNotInterface(t *testing.T) {
+	g := &Game{}
+	if err := g.RegisterBehaviour(reflect.TypeOf(0)); err == nil {
+		t.Error("RegisterBehaviour(int) = nil, want error")
+	}
+}
+
+type fakeUpdater func() error
+
+func (f fakeUpdater) Update() error { return f() }
+
+func TestGameUpdateRunsDeferred(t *testing.T) {
+	g := &Game{}
+	var got []string
+	u := fakeUpdater(func() error {
+		got = append(got, "update")
+		g.Defer(func() error {
+			got = append(got, "deferred")
+			g.Defer(func() error {
+				got = append(got, "nested")
+				return nil
+			})
+			return nil
+		})
+		return nil
+	})
+	g.Root = &DrawDFS{Child: &u}
+	if err := g.LoadAndPrepare(nil); err != nil {
+		t.Fatalf("LoadAndPrepare(nil) = %v, want nil", err)
+	}
+	if err := g.Update(); err != nil {
+		t.Fatalf("Update() = %v, want nil", err)
+	}
+	if want := []string{"update", "deferred"}; !cmp.Equal(got, want) {
+		t.Errorf("calls after first Update = %v, want %v", got, want)
+	}
+	// Functions deferred by deferred functions wait for the next Update.
+	if err := g.Update(); err != nil {
+		t.Fatalf("Update() = %v, want nil", err)
+	}
+	if want := []string{"update", "deferred", "update", "nested", "deferred"}; !cmp.Equal(got, want) {
+		t.Errorf("calls after second Update = %v, want %v", got, want)
+	}
+}
+
+type fakeLifecycle struct {
+	name  string
+	child any
+	log   *[]string
+}
+
+func (f *fakeLifecycle) Registered(any) { *f.log = append(*f.log, "registered "+f.name) }
+func (f *fakeLifecycle) Dispose()       { *f.log = append(*f.log, "disposed "+f.name) }
+
+func (f *fakeLifecycle) Scan(visit VisitFunc) error {
+	if f.child == nil {
+		return nil
+	}
+	return visit(f.child)
+}
+
+func TestGameLifecycleHooks(t *testing.T) {
+	var log []string
+	child := &fakeLifecycle{name: "child", log: &log}
+	parent := &fakeLifecycle{name: "parent", child: child, log: &log}
+	g := &Game{Root: &DrawDFS{Child: MakeContainer()}}
+	if err := g.LoadAndPrepare(nil); err != nil {
+		t.Fatalf("LoadAndPrepare(nil) = %v, want nil", err)
+	}
+	if err := g.Register(parent, g.Root); err != nil {
+		t.Fatalf("Register(parent, g.Root) = %v, want nil", err)
+	}
+	g.Unregister(parent)
+	want := []string{
+		"registered parent",
+		"registered child",
+		"disposed child",
+		"disposed parent",
+	}
+	if diff := cmp.Diff(log, want); diff != "" {
+		t.Errorf("hook calls diff (-got +want):\n%s", diff)
+	}
+}
+
+type fakePhased struct {
+	name string
+	log  *[]string
+}
+
+func (f *fakePhased) UpdateInput() error {
+	*f.log = append(*f.log, "input "+f.name)
+	return nil
+}
+
+func (f *fakePhased) Update() error {
+	*f.log = append(*f.log, "update "+f.name)
+	return nil
+}
+
+func (f *fakePhased) UpdatePostPhysics() error {
+	*f.log = append(*f.log, "post "+f.name)
+	return nil
+}
+
+func TestGameUpdatePhases(t *testing.T) {
+	var log []string
+	g := &Game{
+		Root: &DrawDFS{Child: MakeContainer(
+			&fakePhased{name: "a", log: &log},
+			&fakePhased{name: "b", log: &log},
+		)},
+	}
+	if err := g.LoadAndPrepare(nil); err != nil {
+		t.Fatalf("LoadAndPrepare(nil) = %v, want nil", err)
+	}
+	if err := g.Update(); err != nil {
+		t.Fatalf("Update() = %v, want nil", err)
+	}
+	want := []string{
+		"input a", "input b",
+		"update a", "update b",
+		"post a", "post b",
+	}
+	if diff := cmp.Diff(log, want); diff != "" {
+		t.Errorf("update calls diff (-got +want):\n%s", diff)
+	}
+}
+
+func TestGameClock(t *testing.T) {
+	normal, slow := 0, 0
+	n := fakeUpdater(func() error { normal++; return nil })
+	s := fakeUpdater(func() error { slow++; return nil })
+	g := &Game{
+		Root: &DrawDFS{Child: MakeContainer(
+			&n,
+			&TimeWarp{Factor: 0.5, Child: &s},
+		)},
+	}
+	if err := g.LoadAndPrepare(nil); err != nil {
+		t.Fatalf("LoadAndPrepare(nil) = %v, want nil", err)
+	}
+	for i := 0; i < 4; i++ {
+		if err := g.Update(); err != nil {
+			t.Fatalf("Update() = %v, want nil", err)
+		}
+	}
+	if got, want := g.Tick(), uint64(4); got != want {
+		t.Errorf("after 4 updates: Tick() = %d, want %d", got, want)
+	}
+	if normal != 4 || slow != 2 {
+		t.Errorf("after 4 updates: (normal, slow) = (%d, %d), want (4, 2)", normal, slow)
+	}
+
+	g.SetTimeScale(0)
+	if err := g.Update(); err != nil {
+		t.Fatalf("Update() = %v, want nil", err)
+	}
+	if got, want := g.Tick(), uint64(4); got != want {
+		t.Errorf("after frozen update: Tick() = %d, want %d", got, want)
+	}
+	if normal != 4 {
+		t.Errorf("after frozen update: normal = %d, want 4", normal)
+	}
+}
+
+func TestGameUpdateTimeWarp(t *testing.T) {
+	var log []string
+	g := &Game{
+		Root: &DrawDFS{Child: MakeContainer(
+			&TimeWarp{Factor: 2, Child: &fakePhased{name: "fast", log: &log}},
+			&TimeWarp{Child: &fakePhased{name: "zero", log: &log}},
+		)},
+	}
+	if err := g.LoadAndPrepare(nil); err != nil {
+		t.Fatalf("LoadAndPrepare(nil) = %v, want nil", err)
+	}
+	if err := g.Update(); err != nil {
+		t.Fatalf("Update() = %v, want nil", err)
+	}
+	// Input is read once per frame; the zero TimeWarp runs at normal speed.
+	want := []string{
+		"input fast", "input zero",
+		"update fast", "update zero",
+		"post fast", "post zero",
+		"update fast",
+		"post fast",
+	}
+	if diff := cmp.Diff(log, want); diff != "" {
+		t.Errorf("update calls diff (-got +want):\n%s", diff)
+	}
+}
+
+func TestGameTimers(t *testing.T) {
+	owner := &Scene{ID: "owner", Child: MakeContainer()}
+	g := &Game{Root: &DrawDFS{Child: owner}}
+	if err := g.LoadAndPrepare(nil); err != nil {
+		t.Fatalf("LoadAndPrepare(nil) = %v, want nil", err)
+	}
+	after, every := 0, 0
+	g.After(owner, 2, func() { after++ })
+	g.Every(owner, 1, func() { every++ })
+
+	update := func() {
+		t.Helper()
+		if err := g.Update(); err != nil {
+			t.Fatalf("Update() = %v, want nil", err)
+		}
+	}
+	update()
+	update()
+	update()
+	if after != 1 || every != 3 {
+		t.Errorf("after 3 updates: (after, every) = (%d, %d), want (1, 3)", after, every)
+	}
+
+	owner.Disable()
+	update()
+	if every != 3 {
+		t.Errorf("after disabled update: every = %d, want 3", every)
+	}
+
+	owner.Enable()
+	g.Unregister(owner)
+	update()
+	if every != 3 {
+		t.Errorf("after unregistered update: every = %d, want 3", every)
+	}
+
+	// Timers for owners that aren't registered are cancelled straight away.
+	tm := g.Every(owner, 1, func() { every++ })
+	if tm.Active() {
+		t.Error("Every(unregistered owner).Active() = true, want false")
+	}
+	if err := g.Register(owner, g.Root); err != nil {
+		t.Fatalf("Register(owner) = %v, want nil", err)
+	}
+	update()
+	if every != 3 {
+		t.Errorf("after update with owner registered again: every = %d, want 3", every)
+	}
+	if n := len(g.timers); n != 0 {
+		t.Errorf("len(g.timers) = %d, want 0", n)
+	}
+}
+
+func TestGameScopedIDs(t *testing.T) {
+	xa, xb := &Scene{ID: "x", Child: MakeContainer()}, &Scene{ID: "x", Child: MakeContainer()}
+	a := &Scene{ID: "a", Child: xa}
+	b := &Scene{ID: "b", Child: xb}
+	g := &Game{Root: &DrawDFS{Child: MakeContainer(a, b)}}
+	if err := g.LoadAndPrepare(nil); err != nil {
+		t.Fatalf("LoadAndPrepare(nil) = %v, want nil", err)
+	}
+
+	tests := []struct {
+		from any
+		path string
+		want Identifier
+	}{
+		{from: g, path: "a/x", want: xa},
+		{from: g, path: "b/x", want: xb},
+		{from: g, path: "x", want: nil},
+		{from: xa, path: "b", want: b},
+		{from: a, path: "x", want: xa},
+		{from: xb, path: "/a/x", want: xa},
+	}
+	for _, test := range tests {
+		if got := g.LookupFrom(test.from, test.path); got != test.want {
+			t.Errorf("LookupFrom(%v, %q) = %v, want %v", test.from, test.path, got, test.want)
+		}
+	}
+
+	if err := g.Register(&Scene{ID: "x"}, a); err == nil {
+		t.Error("Register(duplicate x, a) = nil, want error")
+	}
+}
+
+func TestGameLifecycleHooksRebuild(t *testing.T) {
+	var log []string
+	stays := &fakeLifecycle{name: "stays", log: &log}
+	goes := &fakeLifecycle{name: "goes", log: &log}
+	arrives := &fakeLifecycle{name: "arrives", log: &log}
+	c := MakeContainer(stays, goes)
+	g := &Game{Root: &DrawDFS{Child: c}}
+	if err := g.LoadAndPrepare(nil); err != nil {
+		t.Fatalf("LoadAndPrepare(nil) = %v, want nil", err)
+	}
+	log = nil
+
+	c.Remove(goes)
+	c.Add(arrives)
+	if err := g.LoadAndPrepare(nil); err != nil {
+		t.Fatalf("LoadAndPrepare(nil) again = %v, want nil", err)
+	}
+	want := []string{"registered arrives", "disposed goes"}
+	if diff := cmp.Diff(log, want); diff != "" {
+		t.Errorf("hook calls diff (-got +want):\n%s", diff)
+	}
+}
+
+func TestGameRegisterFailure(t *testing.T) {
+	var log []string
+	dup := &Scene{ID: "dup", Child: MakeContainer()}
+	child := &fakeLifecycle{name: "child", child: &Scene{ID: "dup", Child: MakeContainer()}, log: &log}
+	parent := &fakeLifecycle{name: "parent", child: child, log: &log}
+	g := &Game{Root: &DrawDFS{Child: MakeContainer(dup)}}
+	if err := g.LoadAndPrepare(nil); err != nil {
+		t.Fatalf("LoadAndPrepare(nil) = %v, want nil", err)
+	}
+	if err := g.Register(parent, g.Root); err == nil {
+		t.Error("Register(parent, g.Root) = nil, want error (duplicate id)")
+	}
+	if len(log) != 0 {
+		t.Errorf("hooks called after failed Register: %v", log)
+	}
+	for _, c := range []any{parent, child} {
+		if p := g.Parent(c); p != nil {
+			t.Errorf("Parent(%v) = %v after failed Register, want nil", c, p)
+		}
+	}
+	if got := g.Component("dup"); got != dup {
+		t.Errorf("Component(dup) = %v, want the original", got)
+	}
+}
+
+func TestGameReparent(t *testing.T) {
+	var log []string
+	mover := &fakeLifecycle{name: "mover", child: fakeDrawBoxer("d"), log: &log}
+	from, to := MakeContainer(mover), MakeContainer()
+	g := &Game{Root: &DrawDFS{Child: MakeContainer(from, to)}}
+	if err := g.LoadAndPrepare(nil); err != nil {
+		t.Fatalf("LoadAndPrepare(nil) = %v, want nil", err)
+	}
+	log = nil
+
+	if err := g.Reparent(mover, to); err != nil {
+		t.Fatalf("Reparent(mover, to) = %v, want nil", err)
+	}
+	if got := g.Parent(mover); got != to {
+		t.Errorf("Parent(mover) = %v, want %v", got, to)
+	}
+	if from.Contains(mover) || !to.Contains(mover) {
+		t.Errorf("after Reparent: from = %v, to = %v; want mover moved from from to to", from, to)
+	}
+	if got, err := QueryAll[Drawer](g, from, 0); err != nil || got != nil {
+		t.Errorf("QueryAll[Drawer](g, from) = (%v, %v), want (nil, nil)", got, err)
+	}
+	got, err := QueryAll[Drawer](g, to, 0)
+	if err != nil {
+		t.Errorf("QueryAll[Drawer](g, to) error = %v, want nil", err)
+	}
+	if want := []Drawer{fakeDrawBoxer("d")}; !cmp.Equal(got, want) {
+		t.Errorf("QueryAll[Drawer](g, to) = %v, want %v", got, want)
+	}
+	if len(log) != 0 {
+		t.Errorf("lifecycle hooks called during Reparent: %v", log)
+	}
+	if err := g.Reparent(from, mover); err != nil {
+		t.Errorf("Reparent(from, mover) = %v, want nil", err)
+	}
+	if err := g.Reparent(to, mover); err == nil {
+		t.Error("Reparent(to, mover) = nil, want error (cycle)")
+	}
+}
+
+// fakeRegistrar is a container that records which components it has been
+// told about, and can refuse to register them.
+type fakeRegistrar struct {
+	child any
+	fail  error
+	seen  map[any]bool
+}
+
+func (f *fakeRegistrar) Register(component, _ any) error {
+	if f.fail != nil {
+		return f.fail
+	}
+	f.seen[component] = true
+	return nil
+}
+
+func (f *fakeRegistrar) Unregister(component any) { delete(f.seen, component) }
+
+func (f *fakeRegistrar) Scan(visit VisitFunc) error { return visit(f.child) }
+
+func TestGameReparentAtomic(t *testing.T) {
+	mover := &Scene{ID: "x", Child: MakeContainer()}
+	clash := &Scene{ID: "x", Child: MakeContainer()}
+	from, to, other := MakeContainer(mover), MakeContainer(clash), MakeContainer()
+	oldReg := &fakeRegistrar{child: from, seen: make(map[any]bool)}
+	newReg := &fakeRegistrar{
+		child: MakeContainer(&Scene{ID: "dest", Child: to}, other),
+		seen:  make(map[any]bool),
+	}
+	g := &Game{Root: &DrawDFS{Child: MakeContainer(oldReg, newReg)}}
+	if err := g.LoadAndPrepare(nil); err != nil {
+		t.Fatalf("LoadAndPrepare(nil) = %v, want nil", err)
+	}
+	oldReg.seen[mover] = true
+
+	check := func(when string) {
+		t.Helper()
+		if got := g.Parent(mover); got != from {
+			t.Errorf("%s: Parent(mover) = %v, want %v", when, got, from)
+		}
+		if !from.Contains(mover) || to.Contains(mover) || other.Contains(mover) {
+			t.Errorf("%s: mover moved between containers", when)
+		}
+		if !oldReg.seen[mover] || newReg.seen[mover] {
+			t.Errorf("%s: oldReg.seen = %v, newReg.seen = %v; want mover only in oldReg", when, oldReg.seen, newReg.seen)
+		}
+		if got := g.LookupFrom(from, "x"); got != mover {
+			t.Errorf("%s: LookupFrom(from, x) = %v, want mover", when, got)
+		}
+	}
+
+	// Duplicate ID: nothing should change, and no Registrar should be told.
+	if err := g.Reparent(mover, to); err == nil {
+		t.Error("Reparent(mover, to) = nil, want error (duplicate id)")
+	}
+	check("after duplicate id")
+
+	// Registrar refuses: the move should be undone.
+	errNope := errors.New("nope")
+	newReg.fail = errNope
+	if err := g.Reparent(mover, other); !errors.Is(err, errNope) {
+		t.Errorf("Reparent(mover, other) = %v, want %v", err, errNope)
+	}
+	check("after Register failed")
+}
+
+func TestGameValidate(t *testing.T) {
+	good := &Parallax{CameraID: "cam", Child: MakeContainer()}
+	bad := &Parallax{CameraID: "nope", Child: MakeContainer()}
+	g := &Game{Root: &DrawDFS{Child: MakeContainer(
+		&Camera{ID: "cam", Child: MakeContainer()},
+		good,
+		bad,
+		&DrawDAG{Child: MakeContainer()}, // ChunkSize = 0
+	)}}
+	err := g.Validate(nil)
+	errs, ok := err.(ValidationErrors)
+	if !ok {
+		t.Fatalf("Validate(nil) = %v, want ValidationErrors", err)
+	}
+	if len(errs) != 2 {
+		t.Fatalf("Validate(nil) found %d problems, want 2: %v", len(errs), errs)
+	}
+	if got := errs[0].Component; got != bad {
+		t.Errorf("errs[0].Component = %v, want %v", got, bad)
+	}
+	if _, ok := errs[1].Component.(*DrawDAG); !ok {
+		t.Errorf("errs[1].Component = %T, want *DrawDAG", errs[1].Component)
+	}
+}
+
+func TestGameValidateUnbuilt(t *testing.T) {
+	var log []string
+	lc := &fakeLifecycle{name: "lc", log: &log}
+	g := &Game{Root: &DrawDFS{Child: MakeContainer(
+		&Camera{ID: "cam", Child: MakeContainer()},
+		&Parallax{CameraID: "cam", Child: MakeContainer()},
+		lc,
+	)}}
+	if err := g.Validate(nil); err != nil {
+		t.Fatalf("Validate(nil) = %v, want nil", err)
+	}
+	if g.parent != nil {
+		t.Error("Validate(nil) built g's database, want it left unbuilt")
+	}
+	if len(log) != 0 {
+		t.Errorf("lifecycle hooks called during Validate: %v", log)
+	}
+	if err := g.LoadAndPrepare(nil); err != nil {
+		t.Fatalf("LoadAndPrepare(nil) = %v, want nil", err)
+	}
+	if want := []string{"registered lc"}; !cmp.Equal(log, want) {
+		t.Errorf("hook calls = %v, want %v", log, want)
+	}
+}
+
+func TestGameValidateLoadErrors(t *testing.T) {
+	tm := &Tilemap{
+		ID: "tiles",
+		Map: map[image.Point]Tile{
+			{0, 0}: &AnimatedTile{AnimKey: "missing"},
+		},
+		Sheet: Sheet{CellSize: image.Pt(8, 8)},
+	}
+	g := &Game{Root: &DrawDFS{Child: MakeContainer(tm)}}
+	err := g.Validate(nil)
+	errs, ok := err.(ValidationErrors)
+	if !ok || len(errs) != 1 {
+		t.Fatalf("Validate(nil) = %v, want 1 ValidationError", err)
+	}
+	if got, want := errs[0].Path, `Game/DrawDFS/Container/"tiles"`; got != want {
+		t.Errorf("errs[0].Path = %q, want %q", got, want)
+	}
+}
+
+func TestGameLogger(t *testing.T) {
+	var msgs []string
+	g := &Game{Root: &DrawDFS{Child: MakeContainer()}}
+	g.SetLogger(LoggerFunc(func(level LogLevel, msg string, fields ...Field) {
+		if len(fields) != 1 || fields[0].Key != "duration" {
+			t.Errorf("Log(%v, %q, %v): want a single duration field", level, msg, fields)
+		}
+		msgs = append(msgs, msg)
+	}))
+	if err := g.LoadAndPrepare(nil); err != nil {
+		t.Fatalf("LoadAndPrepare(nil) = %v, want nil", err)
+	}
+	want := []string{"finished loading", "finished building db", "finished preparing"}
+	if diff := cmp.Diff(msgs, want); diff != "" {
+		t.Errorf("logged messages diff:\n%s", diff)
+	}
+	if s := g.LoadStats(); s.Load < 0 || s.Build < 0 || s.Prepare < 0 {
+		t.Errorf("LoadStats() = %+v, want non-negative durations", s)
+	}
+}
@@ -0,0 +1,123 @@
+/*
+Copyright 2021 Josh Deprez
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import (
+	"io/fs"
+	"sort"
+	"time"
+)
+
+// Ensure AssetWatcher satisfies interfaces.
+var _ interface {
+	Disposer
+	Prepper
+} = &AssetWatcher{}
+
+func init() {
+	RegisterType(&AssetWatcher{})
+}
+
+// DefaultWatchPeriod is the number of ticks between polls by an AssetWatcher
+// with zero Period.
+const DefaultWatchPeriod = 30
+
+// AssetWatcher reloads assets that have changed, without reloading the whole
+// game. It polls the modification times of the files used by every Reloader in
+// the game, which works with any fs.FS that reports modification times (such
+// as os.DirFS), but not with embed.FS. To use it, add an AssetWatcher anywhere
+// in the game tree. Disabling the AssetWatcher pauses polling.
+type AssetWatcher struct {
+	Period int // ticks between polls; DefaultWatchPeriod if zero
+
+	game   *Game
+	timer  *Timer
+	mtimes map[string]time.Time
+}
+
+// Prepare starts polling.
+func (w *AssetWatcher) Prepare(game *Game) error {
+	w.game = game
+	w.mtimes = make(map[string]time.Time)
+	period := w.Period
+	if period <= 0 {
+		period = DefaultWatchPeriod
+	}
+	if w.timer != nil {
+		w.timer.Cancel()
+	}
+	w.timer = game.Every(w, period, w.Poll)
+	return nil
+}
+
+// Dispose stops polling.
+func (w *AssetWatcher) Dispose() {
+	if w.timer != nil {
+		w.timer.Cancel()
+		w.timer = nil
+	}
+}
+
+// Poll checks every Reloader's file for changes, and reloads those that have
+// changed. Poll is called periodically once w is prepared, but can also be
+// called directly.
+func (w *AssetWatcher) Poll() {
+	g := w.game
+	assets := g.assets
+	if assets == nil {
+		return
+	}
+	byPath := make(map[string][]Reloader)
+	walkEach(g, g, func(r Reloader) {
+		if p := r.AssetPath(); p != "" {
+			byPath[p] = append(byPath[p], r)
+		}
+	})
+
+	var changed []string
+	for p := range byPath {
+		fi, err := fs.Stat(assets, p)
+		if err != nil {
+			g.Log(LevelDebug, "AssetWatcher: couldn't stat", F("path", p), F("err", err))
+			continue
+		}
+		prev, seen := w.mtimes[p]
+		w.mtimes[p] = fi.ModTime()
+		if seen && !fi.ModTime().Equal(prev) {
+			changed = append(changed, p)
+		}
+	}
+	sort.Strings(changed)
+	for _, p := range changed {
+		g.Log(LevelInfo, "AssetWatcher: reloading", F("path", p), F("components", len(byPath[p])))
+		g.ReloadAsset(p, byPath[p]...)
+	}
+}
+
+// ReloadAsset reloads the asset at path (in the assets passed to
+// LoadAndPrepare), by forgetting it from the asset cache and calling Reload
+// on each of the given Reloaders. Any errors are logged. The old value is left
+// for the asset cache to dispose in a later Sweep, since components that are
+// not registered (e.g. in a popped scene) may still refer to it.
+func (g *Game) ReloadAsset(path string, reloaders ...Reloader) {
+	g.AssetCache().Forget(g.assets, path)
+	for _, r := range reloaders {
+		if err := r.Reload(g, g.assets); err != nil {
+			g.Log(LevelError, "couldn't reload", F("path", path), F("component", r), F("err", err))
+		}
+	}
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2021 Josh Deprez
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/gob"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func gobz(t *testing.T, v any) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if err := gob.NewEncoder(gz).Encode(v); err != nil {
+		t.Fatalf("Encode(%v) = %v", v, err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatalf("gz.Close() = %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestAssetWatcherReloadsSceneRef(t *testing.T) {
+	t0 := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	assets := fstest.MapFS{
+		"level.gobz": &fstest.MapFile{
+			Data:    gobz(t, &Scene{ID: "before", Child: MakeContainer()}),
+			ModTime: t0,
+		},
+	}
+	ref := &SceneRef{Path: "level.gobz"}
+	g := &Game{Root: &DrawDFS{Child: MakeContainer(&AssetWatcher{Period: 1}, ref)}}
+	if err := g.LoadAndPrepare(assets); err != nil {
+		t.Fatalf("LoadAndPrepare() = %v, want nil", err)
+	}
+	parent := g.Parent(ref)
+	ref.Hide()
+
+	update := func() {
+		t.Helper()
+		if err := g.Update(); err != nil {
+			t.Fatalf("Update() = %v, want nil", err)
+		}
+	}
+	update() // first poll records mtimes
+	if got, want := ref.Ident(), "before"; got != want {
+		t.Fatalf("before change: ref.Ident() = %q, want %q", got, want)
+	}
+
+	assets["level.gobz"] = &fstest.MapFile{
+		Data:    gobz(t, &Scene{ID: "after", Child: MakeContainer()}),
+		ModTime: t0.Add(time.Second),
+	}
+	update()
+	if got, want := ref.Ident(), "after"; got != want {
+		t.Errorf("after change: ref.Ident() = %q, want %q", got, want)
+	}
+	if got := g.Component("after"); got != ref {
+		t.Errorf("Component(after) = %v, want %v", got, ref)
+	}
+	if got := g.Component("before"); got != nil {
+		t.Errorf("Component(before) = %v, want nil", got)
+	}
+	if got := g.Parent(ref); got != parent {
+		t.Errorf("Parent(ref) = %v, want %v", got, parent)
+	}
+	if !ref.Hidden() {
+		t.Error("ref.Hidden() = false after reload, want true")
+	}
+}
@@ -17,22 +17,25 @@ limitations under the License.
 package engine
 
 import (
-	"encoding/gob"
+	"context"
 	"image"
 	"io/fs"
 
 	"github.com/hajimehoshi/ebiten/v2"
 )
 
-var (
-	imageCache = make(map[assetKey]*ebiten.Image)
-
-	// Ensure types satisfy interfaces.
-	_ Loader = &ImageRef{}
-)
+// Ensure ImageRef satisfies interfaces.
+var _ interface {
+	ContextLoader
+	Disposer
+	Loader
+	Registeree
+	Reloader
+	Validator
+} = &ImageRef{}
 
 func init() {
-	gob.Register(&ImageRef{})
+	RegisterType(&ImageRef{})
 }
 
 // ImageRef loads images from the AssetFS into *ebiten.Image form. It is your
@@ -42,7 +45,10 @@ func init() {
 type ImageRef struct {
 	Path string
 
-	image *ebiten.Image
+	image  *ebiten.Image
+	assets fs.FS       // where image came from
+	cache  *AssetCache // cache holding image, if any
+	held   bool        // whether a reference to the cache entry is held
 }
 
 // Image returns the image, or nil if not loaded. Multiple distinct ImageRefs
@@ -51,27 +57,107 @@ func (r *ImageRef) Image() *ebiten.Image {
 	return r.image
 }
 
-// Load loads the image. Load is required before Image returns. Loading the same
-// path multiple times uses a cache to return the same image.
+// Load loads the image. Load is required before Image returns. Load does not
+// use the game's asset cache: each call decodes the file into a new image that
+// is not shared with other ImageRefs, and is never freed by Sweep. Usually it
+// is better to let Game load the ImageRef (which uses LoadContext).
 func (r *ImageRef) Load(assets fs.FS) error {
-	// Fast path load from cache
-	r.image = imageCache[assetKey{assets, r.Path}]
-	if r.image != nil {
+	return r.LoadContext(context.Background(), assets)
+}
+
+// LoadContext loads the image. If ctx carries an AssetCache (see
+// WithAssetCache), the image is shared with every other ImageRef using the
+// same path. It is safe to load different ImageRefs concurrently.
+func (r *ImageRef) LoadContext(ctx context.Context, assets fs.FS) error {
+	cache := AssetCacheFrom(ctx)
+	if cache == nil {
+		img, _, err := loadImage(assets, r.Path)
+		if err != nil {
+			return err
+		}
+		r.image, r.assets = img.(*ebiten.Image), assets
 		return nil
 	}
-	// Slow path
-	f, err := assets.Open(r.Path)
+	img, err := cache.Get(assets, r.Path, func() (any, int64, error) {
+		return loadImage(assets, r.Path)
+	})
 	if err != nil {
 		return err
 	}
+	// Swap any previously held reference for one to the new image (r may be
+	// loaded again while it stays registered, e.g. by LoadAndPrepare).
+	wasHeld := r.held
+	r.Dispose()
+	r.image, r.assets, r.cache = img.(*ebiten.Image), assets, cache
+	if wasHeld {
+		r.Registered(nil)
+	}
+	return nil
+}
+
+// AssetPath returns r.Path.
+func (r *ImageRef) AssetPath() string { return r.Path }
+
+// Reload loads the image again, and re-prepares the parent component (if it
+// is a Prepper, such as Sheet) in case it depends on the image size.
+func (r *ImageRef) Reload(game *Game, assets fs.FS) error {
+	// The old cache entry is gone, so there is nothing to release.
+	wasHeld := r.held
+	r.held = false
+	ctx := WithAssetCache(context.Background(), game.AssetCache())
+	if err := r.LoadContext(ctx, assets); err != nil {
+		return err
+	}
+	if wasHeld {
+		r.Registered(nil)
+	}
+	if p, ok := game.Parent(r).(Prepper); ok {
+		return p.Prepare(game)
+	}
+	return nil
+}
+
+// Registered acquires a reference to the cached image, so it is kept in the
+// cache while r is registered.
+func (r *ImageRef) Registered(any) {
+	if r.cache == nil || r.held {
+		return
+	}
+	r.held = r.cache.Acquire(r.assets, r.Path)
+}
+
+// Dispose releases the reference to the cached image (if held).
+func (r *ImageRef) Dispose() {
+	if !r.held {
+		return
+	}
+	r.cache.Release(r.assets, r.Path)
+	r.held = false
+}
+
+// loadImage decodes an image file into an *ebiten.Image. It is an
+// AssetLoadFunc (once the arguments are supplied).
+func loadImage(assets fs.FS, path string) (any, int64, error) {
+	f, err := assets.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
 	defer f.Close()
 	i, _, err := image.Decode(f)
 	if err != nil {
-		return err
+		return nil, 0, err
 	}
-	r.image = ebiten.NewImageFromImage(i)
-	imageCache[assetKey{assets, r.Path}] = r.image
-	return nil
+	size := i.Bounds().Size()
+	return ebiten.NewImageFromImage(i), int64(size.X) * int64(size.Y) * 4, nil
+}
+
+// Validate checks that the file at r.Path exists.
+func (r *ImageRef) Validate(_ *Game, assets fs.FS) error {
+	if assets == nil {
+		return nil
+	}
+	_, err := fs.Stat(assets, r.Path)
+	return err
 }
 
 func (r *ImageRef) String() string { return "ImageRef{" + r.Path + "}" }
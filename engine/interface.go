@@ -17,6 +17,7 @@ limitations under the License.
 package engine
 
 import (
+	"context"
 	"image"
 	"io/fs"
 	"reflect"
@@ -29,25 +30,33 @@ import (
 var (
 	// TypeOf(pointer to interface).Elem() is "idiomatic" -
 	// see https://pkg.go.dev/reflect#example-TypeOf
-	BoundingBoxerType  = reflect.TypeOf((*BoundingBoxer)(nil)).Elem()
-	BoundingRecterType = reflect.TypeOf((*BoundingRecter)(nil)).Elem()
-	ColliderType       = reflect.TypeOf((*Collider)(nil)).Elem()
-	DisablerType       = reflect.TypeOf((*Disabler)(nil)).Elem()
-	DrawBoxerType      = reflect.TypeOf((*DrawBoxer)(nil)).Elem()
-	DrawerType         = reflect.TypeOf((*Drawer)(nil)).Elem()
-	DrawManagerType    = reflect.TypeOf((*DrawManager)(nil)).Elem()
-	DrawOrdererType    = reflect.TypeOf((*DrawOrderer)(nil)).Elem()
-	HiderType          = reflect.TypeOf((*Hider)(nil)).Elem()
-	IdentifierType     = reflect.TypeOf((*Identifier)(nil)).Elem()
-	LoaderType         = reflect.TypeOf((*Loader)(nil)).Elem()
-	PrepperType        = reflect.TypeOf((*Prepper)(nil)).Elem()
-	RegistrarType      = reflect.TypeOf((*Registrar)(nil)).Elem()
-	SaverType          = reflect.TypeOf((*Saver)(nil)).Elem()
-	ScannerType        = reflect.TypeOf((*Scanner)(nil)).Elem()
-	TransformerType    = reflect.TypeOf((*Transformer)(nil)).Elem()
-	UpdaterType        = reflect.TypeOf((*Updater)(nil)).Elem()
-
-	// Behaviours lists all the behaviours that can be queried with Game.Query.
+	BoundingBoxerType      = reflect.TypeOf((*BoundingBoxer)(nil)).Elem()
+	BoundingRecterType     = reflect.TypeOf((*BoundingRecter)(nil)).Elem()
+	ColliderType           = reflect.TypeOf((*Collider)(nil)).Elem()
+	DisablerType           = reflect.TypeOf((*Disabler)(nil)).Elem()
+	DrawBoxerType          = reflect.TypeOf((*DrawBoxer)(nil)).Elem()
+	DrawerType             = reflect.TypeOf((*Drawer)(nil)).Elem()
+	DrawManagerType        = reflect.TypeOf((*DrawManager)(nil)).Elem()
+	DrawOrdererType        = reflect.TypeOf((*DrawOrderer)(nil)).Elem()
+	HiderType              = reflect.TypeOf((*Hider)(nil)).Elem()
+	IdentifierType         = reflect.TypeOf((*Identifier)(nil)).Elem()
+	InputUpdaterType       = reflect.TypeOf((*InputUpdater)(nil)).Elem()
+	LoaderType             = reflect.TypeOf((*Loader)(nil)).Elem()
+	PostPhysicsUpdaterType = reflect.TypeOf((*PostPhysicsUpdater)(nil)).Elem()
+	PreDrawUpdaterType     = reflect.TypeOf((*PreDrawUpdater)(nil)).Elem()
+	PrePhysicsUpdaterType  = reflect.TypeOf((*PrePhysicsUpdater)(nil)).Elem()
+	PrepperType            = reflect.TypeOf((*Prepper)(nil)).Elem()
+	RegistrarType          = reflect.TypeOf((*Registrar)(nil)).Elem()
+	SaverType              = reflect.TypeOf((*Saver)(nil)).Elem()
+	ScannerType            = reflect.TypeOf((*Scanner)(nil)).Elem()
+	TimeScalerType         = reflect.TypeOf((*TimeScaler)(nil)).Elem()
+	TransformerType        = reflect.TypeOf((*Transformer)(nil)).Elem()
+	UpdaterType            = reflect.TypeOf((*Updater)(nil)).Elem()
+
+	// Behaviours lists the built-in behaviours that can be queried with
+	// Game.Query. Games can add their own with Game.RegisterBehaviour.
+	// Lifecycle interfaces (Disposer, Registeree, Validator, etc) are not
+	// indexed; the game type-asserts components for those as needed.
 	Behaviours = []reflect.Type{
 		BoundingBoxerType,
 		BoundingRecterType,
@@ -59,11 +68,16 @@ var (
 		DrawOrdererType,
 		HiderType,
 		IdentifierType,
+		InputUpdaterType,
 		LoaderType,
+		PostPhysicsUpdaterType,
+		PreDrawUpdaterType,
+		PrePhysicsUpdaterType,
 		PrepperType,
 		RegistrarType,
 		SaverType,
 		ScannerType,
+		TimeScalerType,
 		TransformerType,
 		UpdaterType,
 	}
@@ -91,6 +105,15 @@ type Disabler interface {
 	Enable()
 }
 
+// Disposer components are told when they have been unregistered from the game
+// (e.g. removed with Unregister, or missing when the game is rebuilt), so
+// that they can release resources. When a subtree is unregistered, Dispose is
+// called on descendants before their ancestors. Dispose is called after the
+// component database has been updated, so it is safe to use Game methods.
+type Disposer interface {
+	Dispose()
+}
+
 // DrawBoxer components can both draw and have a bounding box (used for draw
 // ordering).
 type DrawBoxer interface {
@@ -128,17 +151,51 @@ type Hider interface {
 
 // Identifier components have a sense of self. This makes it easier for
 // components to find and interact with one another. Returning the empty string
-// is treated as having no identifier.
+// is treated as having no identifier. Identifiers must be unique within the
+// nearest enclosing scope (see Scoper).
 type Identifier interface {
 	Ident() string
 }
 
+// InputUpdater components are updated in PhaseInput, which is the first phase
+// of each update. It is intended for reading input, so it runs exactly once
+// per Update, regardless of time scaling.
+type InputUpdater interface {
+	UpdateInput() error
+}
+
 // Loader components get the chance to load themselves. This happens
 // before preparation.
 type Loader interface {
 	Load(fs.FS) error
 }
 
+// ContextLoader components are like Loaders, but can be cancelled. If a
+// component implements both, LoadContext is used instead of Load.
+type ContextLoader interface {
+	LoadContext(context.Context, fs.FS) error
+}
+
+// PostPhysicsUpdater components are updated in PhasePostPhysics, after every
+// Updater has been updated (e.g. so a camera can follow an actor after it has
+// moved).
+type PostPhysicsUpdater interface {
+	UpdatePostPhysics() error
+}
+
+// PreDrawUpdater components are updated in PhasePreDraw, which is the last
+// phase of each update. It is intended for maintaining data structures used
+// for drawing.
+type PreDrawUpdater interface {
+	UpdatePreDraw() error
+}
+
+// PrePhysicsUpdater components are updated in PhasePrePhysics, after input
+// and before any Updater is updated.
+type PrePhysicsUpdater interface {
+	UpdatePrePhysics() error
+}
+
 // Prepper components can be prepared. It is called after the component
 // database has been populated but before the game is run. The component can
 // store the reference to game, if needed, and also query the component database.
@@ -154,9 +211,25 @@ type Registrar interface {
 	Unregister(component any)
 }
 
-// Saver components can be saved to disk.
+// Registeree components are told when they have been registered into the
+// game, and which parent they were registered under. When a subtree is
+// registered, Registered is called on ancestors before their descendants,
+// after the whole subtree has been registered.
+type Registeree interface {
+	Registered(parent any)
+}
+
+// Reloader components load from a single asset file, and can reload it in
+// place when the file changes (see AssetWatcher). Reload is called after
+// the asset has been forgotten from the game's AssetCache.
+type Reloader interface {
+	AssetPath() string
+	Reload(game *Game, assets fs.FS) error
+}
+
+// Saver components can be saved to a WriteFS.
 type Saver interface {
-	Save() error
+	Save(WriteFS) error
 }
 
 // Scanner components can be scanned. It is called when the game tree is walked
@@ -168,6 +241,22 @@ type Scanner interface {
 	Scan(visit VisitFunc) error
 }
 
+// Scoper components introduce a new scope for the IDs of their descendants
+// (see Identifier). IDs only need to be unique within a scope, so a Scoper can
+// be used multiple times in the same game (e.g. two copies of a level). The
+// Scoper's own ID belongs to the enclosing scope. See Game.Lookup.
+type Scoper interface {
+	ScopesIdentifiers()
+}
+
+// TimeScaler components change the rate at which time passes for themselves
+// and their descendants, relative to their ancestors (and ultimately the
+// game's global time scale). For example, a TimeScaler returning 0 freezes
+// its subtree, while one returning 0.5 updates it every second step.
+type TimeScaler interface {
+	TimeScale() float64
+}
+
 // Transformer components can provide draw options to apply to themselves and
 // any child components. The opts passed to Draw of a component c will be the
 // cumulative opts of all parents of c plus the value returned from c.Transform.
@@ -175,9 +264,17 @@ type Transformer interface {
 	Transform() ebiten.DrawImageOptions
 }
 
-// Updater components can update themselves. Update is called repeatedly. Each
-// component must call Update on any internal components not known to the engine
-// (i.e. not passed to Game.Register or returned from Scan).
+// Updater components can update themselves. Update is called repeatedly, in
+// PhasePhysics. Each component must call Update on any internal components not
+// known to the engine (i.e. not passed to Game.Register or returned from Scan).
 type Updater interface {
 	Update() error
 }
+
+// Validator components can check themselves for problems that would otherwise
+// only appear at runtime, such as references to components that don't exist.
+// Validate is called by Game.Validate once the component database is built.
+// assets may be nil, in which case checks needing it should be skipped.
+type Validator interface {
+	Validate(game *Game, assets fs.FS) error
+}
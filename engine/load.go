@@ -0,0 +1,241 @@
+/*
+Copyright 2022 Josh Deprez
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import (
+	"context"
+	"io/fs"
+	"sync"
+)
+
+// ProgressFunc receives loading progress: the number of Loaders (and
+// ContextLoaders) loaded so far, out of the total number known so far. The
+// total can grow as loading proceeds, since loading a component can cause
+// new subcomponents to spring into existence.
+type ProgressFunc func(loaded, total int)
+
+// Load loads a component and all subcomponents recursively.
+// Note that this method does not implement Loader itself.
+func (g *Game) Load(component any, assets fs.FS) error {
+	return g.LoadContext(context.Background(), component, assets, nil)
+}
+
+// LoadContext loads a component and all subcomponents recursively, like Load.
+// ContextLoaders are passed ctx. Loading stops early with ctx.Err() if ctx is
+// cancelled. If progress is not nil, it is called before loading starts and
+// after each Loader or ContextLoader is loaded (calls are never concurrent).
+//
+// Values loaded by ContextLoaders that use an AssetCache (such as ImageRef)
+// are cached in g.AssetCache(), unless ctx already carries a different cache.
+//
+// If g.LoadWorkers > 1, up to that many Loaders are loaded concurrently, so
+// Loaders must be safe to load concurrently with other Loaders. A component's
+// subcomponents are always loaded after the component itself. If any Loader
+// fails, no more Loaders are started, and the first error is returned.
+func (g *Game) LoadContext(ctx context.Context, component any, assets fs.FS, progress ProgressFunc) error {
+	if AssetCacheFrom(ctx) == nil {
+		ctx = WithAssetCache(ctx, g.AssetCache())
+	}
+	l := &loadState{
+		assets:   assets,
+		progress: progress,
+	}
+	if progress != nil {
+		l.total = countLoaders(component)
+		progress(0, l.total)
+	}
+	if g.LoadWorkers <= 1 {
+		l.ctx = ctx
+		return l.load(component)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	l.ctx, l.cancel = ctx, cancel
+	l.cond = sync.NewCond(&l.mu)
+	l.enqueue(component)
+	var wg sync.WaitGroup
+	for i := 0; i < g.LoadWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l.work()
+		}()
+	}
+	wg.Wait()
+	return l.err
+}
+
+// loadState is the state of a single LoadContext call.
+type loadState struct {
+	ctx      context.Context
+	assets   fs.FS
+	progress ProgressFunc
+
+	// Used for concurrent loading only.
+	cancel context.CancelFunc
+	cond   *sync.Cond // signalled when queue or pending change; uses mu
+
+	mu      sync.Mutex // guards the fields below during concurrent loading
+	loaded  int
+	total   int
+	err     error // first error
+	queue   []any // Loaders waiting for a worker
+	pending int   // Loaders queued or being loaded
+}
+
+// load loads component and subcomponents serially.
+func (l *loadState) load(component any) error {
+	// Query cannot be used for this method because Load might cause
+	// subcomponents to spring into existence.
+	if isLoader(component) {
+		if err := l.loadOne(component); err != nil {
+			return err
+		}
+	}
+	if sc, ok := component.(Scanner); ok {
+		return sc.Scan(l.load)
+	}
+	return nil
+}
+
+// enqueue queues component for loading by a worker, if it is a Loader.
+// Components that aren't Loaders are scanned immediately.
+func (l *loadState) enqueue(component any) {
+	if !isLoader(component) {
+		l.scanConcurrent(component)
+		return
+	}
+	l.mu.Lock()
+	l.queue = append(l.queue, component)
+	l.pending++
+	l.mu.Unlock()
+	l.cond.Signal()
+}
+
+// work loads queued Loaders until there are none left to load.
+func (l *loadState) work() {
+	for {
+		l.mu.Lock()
+		for len(l.queue) == 0 && l.pending > 0 {
+			l.cond.Wait()
+		}
+		if len(l.queue) == 0 {
+			// Nothing queued or being loaded: all done.
+			l.mu.Unlock()
+			return
+		}
+		component := l.queue[0]
+		l.queue = l.queue[1:]
+		l.mu.Unlock()
+
+		if err := l.loadOne(component); err != nil {
+			l.fail(err)
+		} else {
+			l.scanConcurrent(component)
+		}
+
+		l.mu.Lock()
+		l.pending--
+		if l.pending == 0 {
+			l.cond.Broadcast()
+		}
+		l.mu.Unlock()
+	}
+}
+
+// scanConcurrent enqueues the subcomponents of component.
+func (l *loadState) scanConcurrent(component any) {
+	sc, ok := component.(Scanner)
+	if !ok {
+		return
+	}
+	sc.Scan(func(x any) error {
+		l.enqueue(x)
+		return nil
+	})
+}
+
+// fail records err (if it is the first error) and stops further loading.
+func (l *loadState) fail(err error) {
+	l.mu.Lock()
+	if l.err == nil {
+		l.err = err
+	}
+	l.mu.Unlock()
+	l.cancel()
+}
+
+// loadOne loads a single Loader or ContextLoader, and reports progress.
+func (l *loadState) loadOne(component any) error {
+	if err := l.ctx.Err(); err != nil {
+		return err
+	}
+	// Subcomponents that appear during loading are added to the total.
+	before := 0
+	if l.progress != nil {
+		before = countLoaders(component)
+	}
+	if err := loadComponent(l.ctx, component, l.assets); err != nil {
+		return err
+	}
+	if l.progress != nil {
+		after := countLoaders(component)
+		l.mu.Lock()
+		l.loaded++
+		l.total += after - before
+		l.progress(l.loaded, l.total)
+		l.mu.Unlock()
+	}
+	return nil
+}
+
+// loadComponent loads a single component, preferring LoadContext over Load.
+func loadComponent(ctx context.Context, component any, assets fs.FS) error {
+	switch c := component.(type) {
+	case ContextLoader:
+		return c.LoadContext(ctx, assets)
+	case Loader:
+		return c.Load(assets)
+	}
+	return nil
+}
+
+// isLoader reports whether component is a Loader or ContextLoader.
+func isLoader(component any) bool {
+	switch component.(type) {
+	case ContextLoader, Loader:
+		return true
+	}
+	return false
+}
+
+// countLoaders counts the Loaders and ContextLoaders in the subtree rooted at
+// component (inclusive), as currently reachable with Scan.
+func countLoaders(component any) int {
+	n := 0
+	if isLoader(component) {
+		n++
+	}
+	if sc, ok := component.(Scanner); ok {
+		sc.Scan(func(x any) error {
+			n += countLoaders(x)
+			return nil
+		})
+	}
+	return n
+}
@@ -0,0 +1,166 @@
+/*
+Copyright 2021 Josh Deprez
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"runtime"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// fakeLoader records the order in which it is loaded.
+type fakeLoader struct {
+	name  string
+	child any
+	err   error
+
+	mu  *sync.Mutex
+	log *[]string
+}
+
+func (f *fakeLoader) Load(fs.FS) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	*f.log = append(*f.log, f.name)
+	return f.err
+}
+
+func (f *fakeLoader) Scan(visit VisitFunc) error {
+	if f.child == nil {
+		return nil
+	}
+	return visit(f.child)
+}
+
+func TestGameLoadContextProgress(t *testing.T) {
+	ref := &SceneRef{Path: "unused"}
+	g := &Game{}
+	root := MakeContainer(DummyLoad{}, DummyLoad{})
+	type progress struct{ loaded, total int }
+	var got []progress
+	if err := g.LoadContext(context.Background(), root, nil, func(loaded, total int) {
+		got = append(got, progress{loaded, total})
+	}); err != nil {
+		t.Fatalf("LoadContext() = %v, want nil", err)
+	}
+	want := []progress{{0, 2}, {1, 2}, {2, 2}}
+	if diff := cmp.Diff(got, want, cmp.AllowUnexported(progress{})); diff != "" {
+		t.Errorf("progress diff:\n%s", diff)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := g.LoadContext(ctx, ref, nil, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("LoadContext(cancelled) = %v, want context.Canceled", err)
+	}
+	if ref.Scene != nil {
+		t.Error("LoadContext(cancelled) loaded the SceneRef")
+	}
+}
+
+func TestGameLoadConcurrent(t *testing.T) {
+	var mu sync.Mutex
+	var log []string
+	var items []any
+	for i := 0; i < 20; i++ {
+		child := &fakeLoader{name: fmt.Sprintf("child%d", i), mu: &mu, log: &log}
+		items = append(items, &fakeLoader{
+			name:  fmt.Sprintf("parent%d", i),
+			child: child,
+			mu:    &mu,
+			log:   &log,
+		})
+	}
+	g := &Game{LoadWorkers: 4}
+	var last int
+	err := g.LoadContext(context.Background(), MakeContainer(items...), nil, func(loaded, total int) {
+		last = loaded
+	})
+	if err != nil {
+		t.Fatalf("LoadContext() = %v, want nil", err)
+	}
+	if last != 40 {
+		t.Errorf("final progress loaded = %d, want 40", last)
+	}
+	pos := make(map[string]int)
+	for i, name := range log {
+		pos[name] = i
+	}
+	if len(pos) != 40 {
+		t.Fatalf("loaded %d distinct loaders, want 40: %v", len(pos), log)
+	}
+	for i := 0; i < 20; i++ {
+		p, c := fmt.Sprintf("parent%d", i), fmt.Sprintf("child%d", i)
+		if pos[p] > pos[c] {
+			t.Errorf("%s loaded after %s", p, c)
+		}
+	}
+}
+
+func TestGameLoadConcurrentError(t *testing.T) {
+	var mu sync.Mutex
+	var log []string
+	errBoom := errors.New("boom")
+	child := &fakeLoader{name: "child", mu: &mu, log: &log}
+	bad := &fakeLoader{name: "bad", child: child, err: errBoom, mu: &mu, log: &log}
+	g := &Game{LoadWorkers: 2}
+	if err := g.Load(MakeContainer(bad), nil); !errors.Is(err, errBoom) {
+		t.Errorf("Load() = %v, want %v", err, errBoom)
+	}
+	if diff := cmp.Diff(log, []string{"bad"}); diff != "" {
+		t.Errorf("loaded diff:\n%s", diff)
+	}
+}
+
+// goroutineCounter records the most goroutines seen while loading.
+type goroutineCounter struct {
+	mu  *sync.Mutex
+	max *int
+}
+
+func (c goroutineCounter) Load(fs.FS) error {
+	n := runtime.NumGoroutine()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if n > *c.max {
+		*c.max = n
+	}
+	return nil
+}
+
+func TestGameLoadConcurrentWorkerPool(t *testing.T) {
+	var mu sync.Mutex
+	max := 0
+	var items []any
+	for i := 0; i < 200; i++ {
+		items = append(items, goroutineCounter{mu: &mu, max: &max})
+	}
+	before := runtime.NumGoroutine()
+	g := &Game{LoadWorkers: 4}
+	if err := g.Load(MakeContainer(items...), nil); err != nil {
+		t.Fatalf("Load() = %v, want nil", err)
+	}
+	if limit := before + g.LoadWorkers; max > limit {
+		t.Errorf("goroutines while loading = %d, want at most %d", max, limit)
+	}
+}
@@ -17,14 +17,26 @@ limitations under the License.
 package engine
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"io/fs"
-	"log"
+	"sync"
 	"time"
 )
 
+// Ensure LoadingSwitch satisfies interfaces.
+var _ interface {
+	Disposer
+	Loader
+	Prepper
+	Scanner
+} = &LoadingSwitch{}
+
 // LoadingSwitch switches between two subcomponents. While After is being
 // loaded asynchronously, During is shown. Once loading is complete, During
-// is hidden and After is shown.
+// is hidden and After is shown. Loading can be cancelled with Cancel, and is
+// cancelled automatically if the LoadingSwitch is unregistered.
 type LoadingSwitch struct {
 	During, After interface {
 		Disabler
@@ -32,6 +44,11 @@ type LoadingSwitch struct {
 	}
 
 	assets fs.FS
+	mu     sync.Mutex // guards the fields below
+	cancel context.CancelFunc
+	loaded int
+	total  int
+	stats  LoadStats
 }
 
 // Scan only scans s.During. Only s.During is loaded automatically - s.After is
@@ -46,40 +63,131 @@ func (s *LoadingSwitch) Load(assets fs.FS) error {
 	return nil
 }
 
-// Prepare loads, registers, and prepares.After in a separate goroutine. Once
-// ready, LoadingSwitch hides s.During and shows s.After.
+// Prepare starts loading s.After in a separate goroutine. Once it is loaded,
+// registered, and prepared, LoadingSwitch hides s.During and shows s.After.
 func (s *LoadingSwitch) Prepare(game *Game) error {
-	go s.loadAfter(game)
+	ctx, cancel := context.WithCancel(context.Background())
+	s.mu.Lock()
+	if s.cancel != nil {
+		// Prepared again: abandon the previous load.
+		s.cancel()
+	}
+	s.cancel = cancel
+	s.loaded, s.total = 0, 0
+	s.mu.Unlock()
+	game.loadInBackground(ctx, s.After, s, s.assets, s.setProgress, func(stats LoadStats, err error) {
+		if errors.Is(err, context.Canceled) {
+			game.Log(LevelInfo, "LoadingSwitch: cancelled")
+			return
+		}
+		if err != nil {
+			game.Log(LevelError, "LoadingSwitch: couldn't load", F("err", err))
+			return
+		}
+		s.mu.Lock()
+		s.stats = stats
+		s.mu.Unlock()
+		game.Log(LevelInfo, "LoadingSwitch: finished", stats.Fields()...)
+
+		// For animated transitions between scenes, see SceneManager.
+		s.During.Disable()
+		s.During.Hide()
+		s.After.Enable()
+		s.After.Show()
+	})
 	return nil
 }
 
-func (s *LoadingSwitch) loadAfter(game *Game) {
-	startLoad := time.Now()
-	if err := game.Load(s.After, s.assets); err != nil {
-		log.Printf("Couldn't load: %v", err)
-		return
+// Cancel stops loading s.After, if it is still in progress.
+func (s *LoadingSwitch) Cancel() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cancel != nil {
+		s.cancel()
 	}
-	log.Printf("LoadingSwitch: finished loading in %v", time.Since(startLoad))
+}
+
+// Dispose cancels loading.
+func (s *LoadingSwitch) Dispose() { s.Cancel() }
 
-	s.After.Disable()
-	s.After.Hide()
+// Progress returns the number of Loaders within s.After loaded so far, out of
+// the total known so far. This can be used by s.During to draw a progress
+// bar. The total can grow while loading is in progress.
+func (s *LoadingSwitch) Progress() (loaded, total int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.loaded, s.total
+}
+
+func (s *LoadingSwitch) setProgress(loaded, total int) {
+	s.mu.Lock()
+	s.loaded, s.total = loaded, total
+	s.mu.Unlock()
+}
+
+// LoadStats returns the durations of the stages of loading s.After. The stats
+// are zero until loading has finished.
+func (s *LoadingSwitch) LoadStats() LoadStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats
+}
+
+// loadInBackground loads component in a separate goroutine (using
+// LoadContext). Then, at the end of a game update (see Defer), it registers
+// component under parent (with PathRegister) and prepares it, so that
+// Registrars such as DrawDAG aren't modified while they are in use. Before
+// registering, component is disabled and hidden (if it is a Disabler or
+// Hider), so that it only appears once the caller enables and shows it.
+// Finally done is called (also at the end of a game update) with the stats and
+// the first error. If ctx is cancelled, or any stage fails, component is left
+// unregistered.
+func (g *Game) loadInBackground(ctx context.Context, component, parent any, assets fs.FS, progress ProgressFunc, done func(LoadStats, error)) {
+	go func() {
+		var stats LoadStats
+		startLoad := time.Now()
+		err := g.LoadContext(ctx, component, assets, progress)
+		stats.Load = time.Since(startLoad)
+		g.Defer(func() error {
+			if err == nil {
+				err = g.registerLoaded(ctx, component, parent, &stats)
+			}
+			done(stats, err)
+			return nil
+		})
+	}()
+}
+
+// registerLoaded is the second half of loadInBackground.
+func (g *Game) registerLoaded(ctx context.Context, component, parent any, stats *LoadStats) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if d, ok := component.(Disabler); ok {
+		d.Disable()
+	}
+	if h, ok := component.(Hider); ok {
+		h.Hide()
+	}
 
 	startBuild := time.Now()
-	if err := game.Register(s.After, s); err != nil {
-		log.Printf("Couldn't register: %v", err)
-		return
+	if err := g.PathRegister(component, parent); err != nil {
+		g.PathUnregister(component)
+		return fmt.Errorf("registering: %w", err)
 	}
-	log.Printf("LoadingSwitch: finished registering in %v", time.Since(startBuild))
+	stats.Build = time.Since(startBuild)
+
 	startPrep := time.Now()
-	if err := game.Prepare(s.After); err != nil {
-		log.Printf("Couldn't prepare: %v", err)
-		return
+	if err := g.Prepare(component); err != nil {
+		g.PathUnregister(component)
+		return fmt.Errorf("preparing: %w", err)
 	}
-	log.Printf("LoadingSwitch: finished preparing in %v", time.Since(startPrep))
+	stats.Prepare = time.Since(startPrep)
 
-	// TODO: better scene transitions
-	s.During.Disable()
-	s.During.Hide()
-	s.After.Enable()
-	s.After.Show()
+	if err := ctx.Err(); err != nil {
+		// Cancelled while registering or preparing.
+		g.PathUnregister(component)
+		return err
+	}
+	return nil
 }
@@ -0,0 +1,160 @@
+/*
+Copyright 2022 Josh Deprez
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// Ensure loggers satisfy Logger.
+var (
+	_ Logger = LoggerFunc(nil)
+	_ Logger = NopLogger{}
+	_ Logger = StdLogger{}
+)
+
+// LogLevel is the severity of a log message.
+type LogLevel int
+
+// The log levels, in increasing order of severity.
+const (
+	LevelDebug LogLevel = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l LogLevel) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	}
+	return fmt.Sprintf("LogLevel(%d)", int(l))
+}
+
+// Field is a key-value pair attached to a log message.
+type Field struct {
+	Key   string
+	Value any
+}
+
+// F is shorthand for Field{Key: key, Value: value}.
+func F(key string, value any) Field { return Field{Key: key, Value: value} }
+
+// Logger is the interface for receiving log messages from the engine.
+// Log may be called from multiple goroutines (e.g. from LoadingSwitch).
+type Logger interface {
+	Log(level LogLevel, msg string, fields ...Field)
+}
+
+// LoggerFunc is a function that implements Logger.
+type LoggerFunc func(level LogLevel, msg string, fields ...Field)
+
+// Log calls f.
+func (f LoggerFunc) Log(level LogLevel, msg string, fields ...Field) {
+	f(level, msg, fields...)
+}
+
+// NopLogger discards all messages.
+type NopLogger struct{}
+
+// Log does nothing.
+func (NopLogger) Log(LogLevel, string, ...Field) {}
+
+// StdLogger writes messages at or above MinLevel to a *log.Logger, as the
+// message followed by key=value pairs. If Logger is nil, the log package's
+// standard logger is used. The zero StdLogger logs everything using the
+// standard logger, and is the default Logger for Game.
+type StdLogger struct {
+	Logger   *log.Logger
+	MinLevel LogLevel
+}
+
+// Log formats and writes the message, if level >= l.MinLevel.
+func (l StdLogger) Log(level LogLevel, msg string, fields ...Field) {
+	if level < l.MinLevel {
+		return
+	}
+	var sb strings.Builder
+	sb.WriteString(msg)
+	for _, f := range fields {
+		fmt.Fprintf(&sb, " %s=%v", f.Key, f.Value)
+	}
+	if l.Logger == nil {
+		log.Print(sb.String())
+		return
+	}
+	l.Logger.Print(sb.String())
+}
+
+// LoadStats records how long each stage of loading took.
+type LoadStats struct {
+	Load    time.Duration
+	Build   time.Duration // or, registering, for LoadingSwitch
+	Prepare time.Duration
+}
+
+// Fields returns the stats as log fields.
+func (s LoadStats) Fields() []Field {
+	return []Field{
+		F("load", s.Load),
+		F("build", s.Build),
+		F("prepare", s.Prepare),
+	}
+}
+
+// Logger returns the logger in use by the game. By default this is
+// StdLogger{}.
+func (g *Game) Logger() Logger {
+	g.logmu.RLock()
+	defer g.logmu.RUnlock()
+	if g.logger == nil {
+		return StdLogger{}
+	}
+	return g.logger
+}
+
+// SetLogger changes the logger used by the game. Passing nil restores the
+// default (StdLogger{}). To silence the engine, use NopLogger{}.
+func (g *Game) SetLogger(l Logger) {
+	g.logmu.Lock()
+	g.logger = l
+	g.logmu.Unlock()
+}
+
+// Log sends a message to the game's logger. Components can use this to log
+// alongside the engine.
+func (g *Game) Log(level LogLevel, msg string, fields ...Field) {
+	g.Logger().Log(level, msg, fields...)
+}
+
+// LoadStats returns the durations of the stages of the most recent call to
+// LoadAndPrepare.
+func (g *Game) LoadStats() LoadStats {
+	g.logmu.RLock()
+	defer g.logmu.RUnlock()
+	return g.loadStats
+}
@@ -0,0 +1,414 @@
+/*
+Copyright 2021 Josh Deprez
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import (
+	"encoding/binary"
+	"math"
+	"sync"
+	"time"
+)
+
+// AudioSampleRate is the sample rate used for all audio, in Hz. Audio files
+// are resampled to this rate when they are loaded.
+const AudioSampleRate = 44100
+
+// Names of the built-in mixer buses. Any other name can be used to create
+// another bus. Every bus feeds into MasterBus.
+const (
+	MasterBus = "master"
+	MusicBus  = "music"
+	SoundBus  = "sound"
+)
+
+// AudioClip is some decoded audio: 16-bit signed stereo samples at
+// AudioSampleRate, interleaved (left, right, left, right, ...).
+type AudioClip struct {
+	Samples []int16
+}
+
+// Frames returns the length of the clip in frames (pairs of samples).
+func (c *AudioClip) Frames() int { return len(c.Samples) / 2 }
+
+// Duration returns the length of the clip in time.
+func (c *AudioClip) Duration() time.Duration {
+	return time.Duration(c.Frames()) * time.Second / AudioSampleRate
+}
+
+// Mixer mixes together any number of playing clips (Voices) into a single
+// stream of audio. Each voice plays on a bus, and each bus has its own volume
+// and can be paused. Mixer implements io.Reader, producing 16-bit signed
+// stereo little-endian samples at AudioSampleRate; usually the game reads it
+// (see Game.Mixer), but it can be read directly (e.g. for testing). It is
+// safe to use a Mixer from multiple goroutines. The zero Mixer is silent and
+// ready to use.
+type Mixer struct {
+	mu      sync.Mutex
+	voices  []*Voice
+	volumes map[string]float64 // by bus; absent means 1
+	paused  map[string]bool    // by bus
+	buf     []float64          // reused by Read
+	discard bool               // no output: don't keep new voices
+}
+
+// Play starts playing clip on the given bus, at full volume. If loop is true,
+// the clip repeats until stopped.
+func (m *Mixer) Play(clip *AudioClip, bus string, loop bool) *Voice {
+	return m.play(clip, bus, loop, 1, nil)
+}
+
+func (m *Mixer) play(clip *AudioClip, bus string, loop bool, volume float64, owner any) *Voice {
+	v := &Voice{
+		m:      m,
+		clip:   clip,
+		bus:    bus,
+		loop:   loop,
+		owner:  owner,
+		volume: volume,
+		gain:   1,
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.discard {
+		v.stopped = true
+		return v
+	}
+	m.prune()
+	m.voices = append(m.voices, v)
+	return v
+}
+
+// prune removes stopped voices. It is called by Read, and also by play and
+// hold, so that voices don't pile up if nothing is reading. m.mu must be held.
+func (m *Mixer) prune() {
+	live := m.voices[:0]
+	for _, v := range m.voices {
+		if !v.stopped {
+			live = append(live, v)
+		}
+	}
+	for i := len(live); i < len(m.voices); i++ {
+		m.voices[i] = nil
+	}
+	m.voices = live
+}
+
+// discardAll stops every voice, and stops any new voices from being kept. It
+// is used when there is no audio output, since then nothing would read the
+// voices to completion.
+func (m *Mixer) discardAll() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, v := range m.voices {
+		v.stopped = true
+	}
+	m.voices = nil
+	m.discard = true
+}
+
+// Volume returns the volume of a bus. The default is 1.
+func (m *Mixer) Volume(bus string) float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.volume(bus)
+}
+
+func (m *Mixer) volume(bus string) float64 {
+	if v, ok := m.volumes[bus]; ok {
+		return v
+	}
+	return 1
+}
+
+// SetVolume sets the volume of a bus (0 is silent, 1 is unchanged).
+// Negative values are treated as 0.
+func (m *Mixer) SetVolume(bus string, volume float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.volumes == nil {
+		m.volumes = make(map[string]float64)
+	}
+	m.volumes[bus] = math.Max(volume, 0)
+}
+
+// Pause pauses a bus. Voices on a paused bus (or on any bus, if MasterBus is
+// paused) don't advance until resumed.
+func (m *Mixer) Pause(bus string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.paused == nil {
+		m.paused = make(map[string]bool)
+	}
+	m.paused[bus] = true
+}
+
+// Resume resumes a paused bus.
+func (m *Mixer) Resume(bus string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.paused, bus)
+}
+
+// Paused reports whether a bus is paused.
+func (m *Mixer) Paused(bus string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.paused[bus]
+}
+
+// StopAll stops every voice.
+func (m *Mixer) StopAll() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, v := range m.voices {
+		v.stopped = true
+	}
+	m.voices = nil
+}
+
+// Voices returns the number of voices still playing (including paused
+// voices).
+func (m *Mixer) Voices() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	for _, v := range m.voices {
+		if !v.stopped {
+			n++
+		}
+	}
+	return n
+}
+
+// hold pauses or unpauses voices that belong to components, according to
+// held. held is called without m.mu held.
+func (m *Mixer) hold(held func(owner any) bool) {
+	m.mu.Lock()
+	owners := make(map[any]bool)
+	for _, v := range m.voices {
+		if v.owner != nil {
+			owners[v.owner] = false
+		}
+	}
+	m.mu.Unlock()
+
+	for o := range owners {
+		owners[o] = held(o)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.prune()
+	for _, v := range m.voices {
+		if h, ok := owners[v.owner]; ok {
+			v.held = h
+		}
+	}
+}
+
+// Read mixes the next len(p)/4 frames of audio into p. It never returns an
+// error, and produces silence if nothing is playing.
+func (m *Mixer) Read(p []byte) (int, error) {
+	frames := len(p) / 4
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if cap(m.buf) < 2*frames {
+		m.buf = make([]float64, 2*frames)
+	}
+	buf := m.buf[:2*frames]
+	for i := range buf {
+		buf[i] = 0
+	}
+
+	if !m.paused[MasterBus] {
+		master := m.volume(MasterBus)
+		for _, v := range m.voices {
+			if v.stopped || v.held || m.paused[v.bus] {
+				continue
+			}
+			vol := master
+			if v.bus != MasterBus {
+				vol *= m.volume(v.bus)
+			}
+			v.mix(buf, vol)
+		}
+		m.prune()
+	}
+
+	for i, s := range buf {
+		s = math.Round(s)
+		if s > math.MaxInt16 {
+			s = math.MaxInt16
+		}
+		if s < math.MinInt16 {
+			s = math.MinInt16
+		}
+		binary.LittleEndian.PutUint16(p[2*i:], uint16(int16(s)))
+	}
+	return 4 * frames, nil
+}
+
+// Voice is a clip being played by a Mixer. Methods on a nil *Voice do
+// nothing.
+type Voice struct {
+	m     *Mixer
+	clip  *AudioClip
+	bus   string
+	loop  bool
+	owner any // component that started it, for pausing; may be nil
+
+	// Guarded by m.mu.
+	pos      int     // next frame to play
+	volume   float64 // when not fading
+	gain     float64 // positional gain, on top of volume
+	pan      float64 // -1 (left) to 1 (right)
+	fadeFrom float64
+	fadeTo   float64
+	fadeLen  int  // in frames; 0 means not fading
+	fadePos  int  // frames of the fade done so far
+	fadeStop bool // stop when the fade is done
+	held     bool // paused because the owner is disabled
+	stopped  bool
+}
+
+// Stop stops the voice. It can't be restarted.
+func (v *Voice) Stop() {
+	if v == nil {
+		return
+	}
+	v.m.mu.Lock()
+	defer v.m.mu.Unlock()
+	v.stopped = true
+}
+
+// Playing reports whether the voice has not yet stopped (or finished). Paused
+// voices are still playing.
+func (v *Voice) Playing() bool {
+	if v == nil {
+		return false
+	}
+	v.m.mu.Lock()
+	defer v.m.mu.Unlock()
+	return !v.stopped
+}
+
+// Volume returns the current volume of the voice (which changes during a
+// fade).
+func (v *Voice) Volume() float64 {
+	if v == nil {
+		return 0
+	}
+	v.m.mu.Lock()
+	defer v.m.mu.Unlock()
+	return v.current()
+}
+
+// SetVolume sets the volume of the voice, cancelling any fade in progress.
+// Negative values are treated as 0.
+func (v *Voice) SetVolume(volume float64) {
+	if v == nil {
+		return
+	}
+	v.m.mu.Lock()
+	defer v.m.mu.Unlock()
+	v.volume, v.fadeLen, v.fadeStop = math.Max(volume, 0), 0, false
+}
+
+// SetSpatial sets a gain (applied on top of the volume, and unaffected by
+// fades) and stereo pan (-1 is fully left, 0 is centred, 1 is fully right).
+// It is used for positional audio (see SoundEmitter).
+func (v *Voice) SetSpatial(gain, pan float64) {
+	if v == nil {
+		return
+	}
+	v.m.mu.Lock()
+	defer v.m.mu.Unlock()
+	v.gain, v.pan = math.Max(gain, 0), math.Max(-1, math.Min(pan, 1))
+}
+
+// FadeTo changes the volume smoothly (linearly) over the duration d.
+func (v *Voice) FadeTo(volume float64, d time.Duration) {
+	v.fade(math.Max(volume, 0), d, false)
+}
+
+// FadeOut fades the volume to 0 over the duration d, then stops the voice.
+func (v *Voice) FadeOut(d time.Duration) {
+	v.fade(0, d, true)
+}
+
+func (v *Voice) fade(to float64, d time.Duration, stop bool) {
+	if v == nil {
+		return
+	}
+	v.m.mu.Lock()
+	defer v.m.mu.Unlock()
+	n := int(math.Round(d.Seconds() * AudioSampleRate))
+	if n <= 0 {
+		v.volume, v.fadeLen = to, 0
+		v.stopped = v.stopped || stop
+		return
+	}
+	v.fadeFrom, v.fadeTo = v.current(), to
+	v.fadeLen, v.fadePos, v.fadeStop = n, 0, stop
+}
+
+// current returns the volume at the current frame.
+func (v *Voice) current() float64 {
+	if v.fadeLen == 0 {
+		return v.volume
+	}
+	t := float64(v.fadePos) / float64(v.fadeLen)
+	return v.fadeFrom + (v.fadeTo-v.fadeFrom)*t
+}
+
+// mix adds the voice's next frames, multiplied by gain, into buf.
+func (v *Voice) mix(buf []float64, gain float64) {
+	n := v.clip.Frames()
+	if n == 0 {
+		v.stopped = true
+		return
+	}
+	// Balance: centre leaves both channels unchanged, and panning to one side
+	// attenuates the other.
+	left := gain * v.gain * math.Min(1, 1-v.pan)
+	right := gain * v.gain * math.Min(1, 1+v.pan)
+	for i := 0; i < len(buf); i += 2 {
+		if v.pos >= n {
+			if !v.loop {
+				v.stopped = true
+				return
+			}
+			v.pos = 0
+		}
+		vol := v.current()
+		buf[i] += float64(v.clip.Samples[2*v.pos]) * left * vol
+		buf[i+1] += float64(v.clip.Samples[2*v.pos+1]) * right * vol
+		v.pos++
+
+		if v.fadeLen > 0 {
+			v.fadePos++
+			if v.fadePos >= v.fadeLen {
+				v.volume, v.fadeLen = v.fadeTo, 0
+				if v.fadeStop {
+					v.stopped = true
+					return
+				}
+			}
+		}
+	}
+}
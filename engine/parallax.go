@@ -17,8 +17,8 @@ limitations under the License.
 package engine
 
 import (
-	"encoding/gob"
 	"fmt"
+	"io/fs"
 
 	"github.com/DrJosh9000/ichigo/geom"
 	"github.com/hajimehoshi/ebiten/v2"
@@ -28,10 +28,11 @@ var _ interface {
 	Prepper
 	Scanner
 	Transformer
+	Validator
 } = &Parallax{}
 
 func init() {
-	gob.Register(&Parallax{})
+	RegisterType(&Parallax{})
 }
 
 // Parallax is a container that translates based on the position of a
@@ -46,14 +47,28 @@ type Parallax struct {
 
 // Prepare obtains a reference to the camera.
 func (p *Parallax) Prepare(game *Game) error {
-	c, ok := game.Component(p.CameraID).(*Camera)
-	if !ok {
-		return fmt.Errorf("component %q type != *Camera", p.CameraID)
+	c, err := p.findCamera(game)
+	if err != nil {
+		return err
 	}
 	p.camera = c
 	return nil
 }
 
+// Validate checks that CameraID refers to a *Camera.
+func (p *Parallax) Validate(game *Game, _ fs.FS) error {
+	_, err := p.findCamera(game)
+	return err
+}
+
+func (p *Parallax) findCamera(game *Game) (*Camera, error) {
+	c, ok := game.LookupFrom(p, p.CameraID).(*Camera)
+	if !ok {
+		return nil, fmt.Errorf("component %q type != *Camera", p.CameraID)
+	}
+	return c, nil
+}
+
 // Scan visits p.Child.
 func (p *Parallax) Scan(visit VisitFunc) error {
 	return visit(p.Child)
@@ -0,0 +1,111 @@
+/*
+Copyright 2022 Josh Deprez
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Phase is a stage of Game.Update. Each phase is run across the whole game
+// tree before the next phase begins. PhaseInput is run once per Update; the
+// other phases are run once per simulation step.
+type Phase int
+
+// The phases, in the order they are run.
+const (
+	PhaseInput       Phase = iota // InputUpdater
+	PhasePrePhysics               // PrePhysicsUpdater
+	PhasePhysics                  // Updater
+	PhasePostPhysics              // PostPhysicsUpdater
+	PhasePreDraw                  // PreDrawUpdater
+
+	numPhases
+)
+
+// phases describes how to run each phase.
+var phases = [numPhases]struct {
+	name      string
+	behaviour reflect.Type
+	update    func(any) error // called on components implementing behaviour
+}{
+	PhaseInput: {
+		name:      "Input",
+		behaviour: InputUpdaterType,
+		update:    func(c any) error { return c.(InputUpdater).UpdateInput() },
+	},
+	PhasePrePhysics: {
+		name:      "PrePhysics",
+		behaviour: PrePhysicsUpdaterType,
+		update:    func(c any) error { return c.(PrePhysicsUpdater).UpdatePrePhysics() },
+	},
+	PhasePhysics: {
+		name:      "Physics",
+		behaviour: UpdaterType,
+		update:    func(c any) error { return c.(Updater).Update() },
+	},
+	PhasePostPhysics: {
+		name:      "PostPhysics",
+		behaviour: PostPhysicsUpdaterType,
+		update:    func(c any) error { return c.(PostPhysicsUpdater).UpdatePostPhysics() },
+	},
+	PhasePreDraw: {
+		name:      "PreDraw",
+		behaviour: PreDrawUpdaterType,
+		update:    func(c any) error { return c.(PreDrawUpdater).UpdatePreDraw() },
+	},
+}
+
+func (p Phase) String() string {
+	if p < 0 || p >= numPhases {
+		return fmt.Sprintf("Phase(%d)", int(p))
+	}
+	return phases[p].name
+}
+
+// updatePhase runs one phase of a simulation step across the game tree.
+// Subcomponents are updated before parent components. Disabled components, and
+// components with a disabled ancestor, are not updated. Except in PhaseInput,
+// components are only updated if their time domain (the game, or the nearest
+// TimeScaler ancestor) has at least step+1 steps to run this tick.
+func (g *Game) updatePhase(p Phase, step int) error {
+	ph := phases[p]
+	timed := p != PhaseInput
+	active := []bool{!timed || step < g.clockSteps[g]}
+	return g.Query(g.Root, ph.behaviour,
+		func(c any) error {
+			if d, ok := c.(Disabler); ok && d.Disabled() {
+				// Do not update this component or descendants.
+				return Skip
+			}
+			if _, ok := c.(TimeScaler); ok {
+				active = append(active, !timed || step < g.clockSteps[c])
+			}
+			return nil
+		},
+		func(c any) error {
+			act := active[len(active)-1]
+			if _, ok := c.(TimeScaler); ok {
+				active = active[:len(active)-1]
+			}
+			if act && reflect.TypeOf(c).Implements(ph.behaviour) {
+				return ph.update(c)
+			}
+			return nil
+		},
+	)
+}
@@ -17,7 +17,6 @@ limitations under the License.
 package engine
 
 import (
-	"encoding/gob"
 	"fmt"
 	"image"
 
@@ -44,8 +43,8 @@ var (
 )
 
 func init() {
-	gob.Register(&PrismMap{})
-	gob.Register(&Prism{})
+	RegisterType(&PrismMap{})
+	RegisterType(&Prism{})
 }
 
 // PrismMap is a generalised 3D tilemap/wallmap/voxelmap etc.
@@ -164,7 +163,7 @@ func (p *Prism) BoundingBox() geom.Box {
 
 // Draw draws the prism.
 func (p *Prism) Draw(screen *ebiten.Image, opts *ebiten.DrawImageOptions) {
-	screen.DrawImage(p.m.Sheet.SubImage(p.Cell), opts)
+	p.m.Sheet.DrawCell(screen, p.Cell, opts)
 }
 
 // DrawAfter reports if the prism should be drawn after x.
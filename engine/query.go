@@ -0,0 +1,131 @@
+/*
+Copyright 2022 Josh Deprez
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// QueryFlags alter which components are visited by QueryEach and QueryAll.
+type QueryFlags uint
+
+const (
+	// SkipDisabled skips disabled components (see Disabler) and all of their
+	// descendants.
+	SkipDisabled QueryFlags = 1 << iota
+
+	// SkipHidden skips hidden components (see Hider) and all of their
+	// descendants.
+	SkipHidden
+)
+
+// Stop is an "error" value that can be returned from a QueryEach visitor to
+// end the query early. QueryEach returns nil when stopped this way.
+const Stop = skip("stop")
+
+// QueryEach calls visit with each registered component implementing T that
+// has the given ancestor (note every component is an ancestor of itself), in
+// a pre-order traversal. Unlike Query, visit is never called for components
+// that don't implement T - those are only used to apply flags.
+//
+// T must be an interface type, otherwise QueryEach panics. T must also be a
+// queryable behaviour (one of Behaviours, or added with RegisterBehaviour),
+// otherwise QueryEach returns an error. QueryEach never changes the set of
+// behaviours itself, since that would rebuild the index from a read.
+//
+// Returning Skip from visit skips the descendants of that component, and
+// returning Stop ends the query. Any other error ends the query and is
+// returned.
+func QueryEach[T any](g *Game, ancestor any, flags QueryFlags, visit func(T) error) error {
+	behaviour := behaviourOf[T]()
+	if !g.isBehaviour(behaviour) {
+		return fmt.Errorf("%v is not a queryable behaviour (see RegisterBehaviour)", behaviour)
+	}
+	err := g.Query(ancestor, behaviour, func(c any) error {
+		if flags&SkipDisabled != 0 {
+			if d, ok := c.(Disabler); ok && d.Disabled() {
+				return Skip
+			}
+		}
+		if flags&SkipHidden != 0 {
+			if h, ok := c.(Hider); ok && h.Hidden() {
+				return Skip
+			}
+		}
+		if t, ok := c.(T); ok {
+			return visit(t)
+		}
+		return nil
+	}, nil)
+	if errors.Is(err, Skip) || errors.Is(err, Stop) {
+		return nil
+	}
+	return err
+}
+
+// QueryAll returns all the registered components implementing T that have the
+// given ancestor, in the same order they would be visited by QueryEach.
+// T must be an interface type, otherwise QueryAll panics. If T is not a
+// queryable behaviour, QueryAll returns an error (see QueryEach).
+func QueryAll[T any](g *Game, ancestor any, flags QueryFlags) ([]T, error) {
+	var all []T
+	err := QueryEach(g, ancestor, flags, func(t T) error {
+		all = append(all, t)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return all, nil
+}
+
+// walkEach calls visit with each registered component implementing T, from
+// component downwards in pre-order. Unlike QueryEach it walks the database
+// directly instead of using an index, which suits interfaces that are only
+// looked for occasionally (e.g. Validator).
+func walkEach[T any](g *Game, component any, visit func(T)) {
+	if t, ok := component.(T); ok {
+		visit(t)
+	}
+	g.Children(component).Scan(func(x any) error {
+		walkEach(g, x, visit)
+		return nil
+	})
+}
+
+// behaviourOf returns the reflect.Type for the interface type T.
+func behaviourOf[T any]() reflect.Type {
+	behaviour := reflect.TypeOf((*T)(nil)).Elem()
+	if behaviour.Kind() != reflect.Interface {
+		panic(fmt.Sprintf("query type %v is not an interface type", behaviour))
+	}
+	return behaviour
+}
+
+// isBehaviour reports whether behaviour can be queried.
+func (g *Game) isBehaviour(behaviour reflect.Type) bool {
+	g.dbmu.RLock()
+	defer g.dbmu.RUnlock()
+	for _, b := range g.allBehaviours() {
+		if b == behaviour {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2022 Josh Deprez
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestQueryAll(t *testing.T) {
+	shown := &Scene{ID: "shown", Child: fakeDrawBoxer("a")}
+	hidden := &Scene{ID: "hidden", Child: fakeDrawBoxer("b"), Hides: true}
+	g := &Game{
+		Root: &DrawDFS{Child: MakeContainer(shown, hidden)},
+	}
+	if err := g.LoadAndPrepare(nil); err != nil {
+		t.Fatalf("LoadAndPrepare(nil) = %v, want nil", err)
+	}
+
+	tests := []struct {
+		flags QueryFlags
+		want  []Identifier
+	}{
+		{flags: 0, want: []Identifier{g, shown, hidden}},
+		{flags: SkipHidden, want: []Identifier{g, shown}},
+	}
+	for _, test := range tests {
+		got, err := QueryAll[Identifier](g, g, test.flags)
+		if err != nil {
+			t.Errorf("QueryAll[Identifier](g, g, %v) error = %v, want nil", test.flags, err)
+		}
+		// Compare by identity; cmp can't look inside Game.
+		if !cmp.Equal(got, test.want, cmp.Comparer(func(x, y Identifier) bool { return x == y })) {
+			t.Errorf("QueryAll[Identifier](g, g, %v) = %v, want %v", test.flags, got, test.want)
+		}
+	}
+}
+
+func TestQueryEachStop(t *testing.T) {
+	g := &Game{
+		Root: &DrawDFS{Child: MakeContainer(fakeDrawBoxer("a"), fakeDrawBoxer("b"))},
+	}
+	if err := g.LoadAndPrepare(nil); err != nil {
+		t.Fatalf("LoadAndPrepare(nil) = %v, want nil", err)
+	}
+	var got []Drawer
+	err := QueryEach(g, g.Root, 0, func(d Drawer) error {
+		if d == g.Root {
+			return nil
+		}
+		got = append(got, d)
+		return Stop
+	})
+	if err != nil {
+		t.Errorf("QueryEach(...) = %v, want nil", err)
+	}
+	if want := []Drawer{fakeDrawBoxer("a")}; !cmp.Equal(got, want) {
+		t.Errorf("visited %v, want %v", got, want)
+	}
+}
+
+type fakeQueried interface{ fakeQueried() }
+
+func TestQueryEachUnregisteredBehaviour(t *testing.T) {
+	g := &Game{Root: &DrawDFS{Child: MakeContainer()}}
+	if err := g.LoadAndPrepare(nil); err != nil {
+		t.Fatalf("LoadAndPrepare(nil) = %v, want nil", err)
+	}
+	visit := func(fakeQueried) error { return nil }
+	if err := QueryEach(g, g, 0, visit); err == nil {
+		t.Error("QueryEach[fakeQueried] before RegisterBehaviour = nil, want error")
+	}
+	if got, err := QueryAll[fakeQueried](g, g, 0); err == nil {
+		t.Errorf("QueryAll[fakeQueried] before RegisterBehaviour = (%v, nil), want error", got)
+	}
+	if err := g.RegisterBehaviour(behaviourOf[fakeQueried]()); err != nil {
+		t.Fatalf("RegisterBehaviour(fakeQueried) = %v, want nil", err)
+	}
+	if err := QueryEach(g, g, 0, visit); err != nil {
+		t.Errorf("QueryEach[fakeQueried] after RegisterBehaviour = %v, want nil", err)
+	}
+}
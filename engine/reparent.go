@@ -0,0 +1,210 @@
+/*
+Copyright 2022 Josh Deprez
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import "fmt"
+
+// Reparent moves a registered component, along with all its registered
+// descendants, so that it becomes a child of newParent (which should also be
+// registered). Unlike unregistering and re-registering:
+//
+//   - the component database is updated in one step,
+//   - no Registered or Dispose hooks are called, and timers are not cancelled,
+//   - component state (e.g. Disables and Hides) is untouched.
+//
+// Registrars on the path to the old parent are told to Unregister the
+// component, and Registrars on the path to newParent are told to Register it
+// (as with PathUnregister and PathRegister, except for the Game itself).
+// IDs are checked for clashes before any Registrar is told anything, and if
+// a Registrar fails to Register the component, the move is undone. Either
+// way, if Reparent returns an error, the component stays where it was.
+//
+// If the old parent is a *Container, the component is removed from it, and if
+// newParent is a *Container, the component is added to it. Otherwise it is up
+// to the caller to update any fields of the parents, so that future Scans
+// agree with the database.
+func (g *Game) Reparent(component, newParent any) error {
+	if component == nil {
+		return errNilComponent
+	}
+	if newParent == nil {
+		return errNilParent
+	}
+
+	g.dbmu.RLock()
+	oldParent, registered := g.parent[component]
+	cyclic := false
+	for p := newParent; p != nil; p = g.parent[p] {
+		if p == component {
+			cyclic = true
+			break
+		}
+	}
+	var err error
+	if registered && !cyclic && oldParent != newParent {
+		// Check for clashing IDs before telling any Registrars anything.
+		_, err = g.planMove(component, newParent)
+	}
+	g.dbmu.RUnlock()
+	switch {
+	case !registered:
+		return fmt.Errorf("component %v is not registered", component)
+	case cyclic:
+		return fmt.Errorf("cannot reparent %v under its own descendant %v", component, newParent)
+	case oldParent == newParent:
+		return nil
+	case err != nil:
+		return err
+	}
+
+	// Registrars on the old path may need to query the database, so notify
+	// them while it still describes the old tree.
+	g.unregisterPath(component, oldParent)
+
+	if err := g.move(component, oldParent, newParent); err != nil {
+		// Nothing moved (e.g. the database changed since the check above).
+		g.registerPath(component, oldParent)
+		return err
+	}
+
+	if err := g.registerPath(component, newParent); err != nil {
+		// Undo the move.
+		g.unregisterPath(component, newParent)
+		if merr := g.move(component, newParent, oldParent); merr != nil {
+			return fmt.Errorf("%w (and couldn't undo the move: %v)", err, merr)
+		}
+		g.registerPath(component, oldParent)
+		return err
+	}
+	return nil
+}
+
+// registerPath calls Register on every Registrar (other than g) in the path
+// from g to parent, top-to-bottom. If one fails, the Registrars that were
+// already told are told to Unregister, and the error is returned.
+func (g *Game) registerPath(component, parent any) error {
+	path := g.Path(parent)
+	for i, p := range path {
+		r, ok := p.(Registrar)
+		if !ok || p == g {
+			continue
+		}
+		if err := r.Register(component, parent); err != nil {
+			for j := i - 1; j >= 0; j-- {
+				if r, ok := path[j].(Registrar); ok && path[j] != g {
+					r.Unregister(component)
+				}
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// unregisterPath calls Unregister on every Registrar (other than g) in the
+// path from parent to g, bottom-to-top.
+func (g *Game) unregisterPath(component, parent any) {
+	for _, p := range g.ReversePath(parent) {
+		if r, ok := p.(Registrar); ok && p != g {
+			r.Unregister(component)
+		}
+	}
+}
+
+// moveEdge is a component in a subtree being moved, with its parent before
+// and after the move.
+type moveEdge struct {
+	component, oldParent, newParent any
+}
+
+// planMove collects the registered subtree rooted at component, in pre-order,
+// with the parent each component will have after moving it under newParent.
+// It returns an error if any IDs would clash in the new scope. g.dbmu must be
+// held (for reading or writing).
+func (g *Game) planMove(component, newParent any) ([]moveEdge, error) {
+	var subtree []moveEdge
+	newScope := g.scopeOf(newParent)
+	var collect func(c, p any, scoped bool) error
+	collect = func(c, p any, scoped bool) error {
+		subtree = append(subtree, moveEdge{c, g.parent[c], p})
+		if i, ok := c.(Identifier); ok && !scoped && i.Ident() != "" {
+			if x, exists := g.scopes[newScope][i.Ident()]; exists && x != i {
+				return fmt.Errorf("duplicate id %q in scope %v", i.Ident(), newScope)
+			}
+		}
+		if _, ok := c.(Scoper); ok {
+			scoped = true
+		}
+		return g.children[c].Scan(func(x any) error {
+			return collect(x, c, scoped)
+		})
+	}
+	if err := collect(component, newParent, false); err != nil {
+		return nil, err
+	}
+	return subtree, nil
+}
+
+// move updates the component database so that component is a child of
+// newParent. If it returns an error, the database is unchanged.
+func (g *Game) move(component, oldParent, newParent any) error {
+	g.dbmu.Lock()
+	defer g.dbmu.Unlock()
+
+	subtree, err := g.planMove(component, newParent)
+	if err != nil {
+		return err
+	}
+	if err := g.relink(subtree, oldParent, newParent, false); err != nil {
+		// planMove should have caught any problem; put everything back.
+		if rerr := g.relink(subtree, newParent, oldParent, true); rerr != nil {
+			panic(fmt.Sprintf("couldn't restore database after failed move: %v (move error: %v)", rerr, err))
+		}
+		return err
+	}
+	return nil
+}
+
+// relink removes the components in subtree from the database and adds them
+// back with their new parents (or old parents, if undo is true). Components
+// that aren't in the database (e.g. after a partially failed relink) are
+// skipped while removing. g.dbmu must be held.
+func (g *Game) relink(subtree []moveEdge, from, to any, undo bool) error {
+	// Descendants appear after ancestors in subtree, so remove in reverse.
+	for i := len(subtree) - 1; i >= 0; i-- {
+		if _, ok := g.parent[subtree[i].component]; ok {
+			g.removeOne(subtree[i].component)
+		}
+	}
+	root := subtree[0].component
+	if c, ok := from.(*Container); ok {
+		c.Remove(root)
+	}
+	if c, ok := to.(*Container); ok {
+		c.Add(root)
+	}
+	for _, e := range subtree {
+		parent := e.newParent
+		if undo {
+			parent = e.oldParent
+		}
+		if err := g.addOne(e.component, parent); err != nil {
+			return err
+		}
+	}
+	return nil
+}
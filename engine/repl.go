@@ -27,7 +27,8 @@ import (
 )
 
 // REPL runs a read-evaluate-print-loop. Commands are taken from src and output
-// is written to dst. assets is needed for commands like reload.
+// is written to dst. assets is needed for commands like reload, and must be a
+// WriteFS for save to work.
 func (g *Game) REPL(src io.Reader, dst io.Writer, assets fs.FS) error {
 	const prompt = "game> "
 	fmt.Fprint(dst, prompt)
@@ -45,7 +46,7 @@ func (g *Game) REPL(src io.Reader, dst io.Writer, assets fs.FS) error {
 		case "resume", "unpause":
 			g.Enable()
 		case "save":
-			g.cmdSave(dst, argv)
+			g.cmdSave(dst, argv, assets)
 		case "reload":
 			g.cmdReload(dst, assets)
 		case "tree":
@@ -58,13 +59,17 @@ func (g *Game) REPL(src io.Reader, dst io.Writer, assets fs.FS) error {
 			g.cmdShow(dst, argv)
 		case "print":
 			g.cmdPrint(dst, argv)
+		case "validate":
+			g.cmdValidate(dst, assets)
+		case "cache":
+			g.cmdCache(dst, argv)
 		}
 		fmt.Fprint(dst, prompt)
 	}
 	return sc.Err()
 }
 
-func (g *Game) cmdSave(dst io.Writer, argv []string) {
+func (g *Game) cmdSave(dst io.Writer, argv []string, assets fs.FS) {
 	c := g.cmdutilComponentArg1(dst, argv)
 	if c == nil {
 		return
@@ -74,7 +79,12 @@ func (g *Game) cmdSave(dst io.Writer, argv []string) {
 		fmt.Fprintf(dst, "Component not saveable (type %T)\n", c)
 		return
 	}
-	if err := s.Save(); err != nil {
+	wfs, ok := assets.(WriteFS)
+	if !ok {
+		fmt.Fprintf(dst, "Assets not writable (type %T)\n", assets)
+		return
+	}
+	if err := s.Save(wfs); err != nil {
 		fmt.Fprintf(dst, "Couldn't save: %v\n", err)
 	}
 }
@@ -128,14 +138,14 @@ func (g *Game) cmdQuery(dst io.Writer, argv []string) {
 	if len(argv) < 2 || len(argv) > 3 {
 		fmt.Fprintln(dst, "Usage: query BEHAVIOUR [ANCESTOR_ID]")
 		fmt.Fprint(dst, "Behaviours:")
-		for _, b := range Behaviours {
+		for _, b := range g.queryableBehaviours() {
 			fmt.Fprintf(dst, " %s", b.Name())
 		}
 		return
 	}
 
 	var behaviour reflect.Type
-	for _, b := range Behaviours {
+	for _, b := range g.queryableBehaviours() {
 		if b.Name() == argv[1] {
 			behaviour = b
 		}
@@ -174,6 +184,13 @@ func (g *Game) cmdQuery(dst io.Writer, argv []string) {
 	}
 }
 
+// queryableBehaviours returns a copy of all the behaviours known to g.
+func (g *Game) queryableBehaviours() []reflect.Type {
+	g.dbmu.RLock()
+	defer g.dbmu.RUnlock()
+	return append([]reflect.Type(nil), g.allBehaviours()...)
+}
+
 func (g *Game) cmdutilComponentArg1(dst io.Writer, argv []string) any {
 	if len(argv) != 2 {
 		fmt.Fprintln(dst, "Usage: hide ID")
@@ -220,3 +237,20 @@ func (g *Game) cmdPrint(dst io.Writer, argv []string) {
 	}
 	fmt.Fprintf(dst, "%#v\n", c)
 }
+
+func (g *Game) cmdValidate(dst io.Writer, assets fs.FS) {
+	if err := g.Validate(assets); err != nil {
+		fmt.Fprintln(dst, err)
+		return
+	}
+	fmt.Fprintln(dst, "No problems found")
+}
+
+func (g *Game) cmdCache(dst io.Writer, argv []string) {
+	c := g.AssetCache()
+	if len(argv) == 2 && argv[1] == "sweep" {
+		fmt.Fprintf(dst, "Swept %d unused assets\n", c.Sweep())
+	}
+	s := c.Stats()
+	fmt.Fprintf(dst, "%d assets (%d bytes), %d unused (%d bytes)\n", s.Entries, s.Bytes, s.Unused, s.UnusedBytes)
+}
@@ -17,9 +17,9 @@ limitations under the License.
 package engine
 
 import (
-	"encoding/gob"
+	"encoding"
 	"io/fs"
-	"path/filepath"
+	"strings"
 )
 
 var (
@@ -27,8 +27,11 @@ var (
 
 	_ interface {
 		Loader
+		Reloader
 		Saver
 		scener
+		encoding.TextMarshaler
+		encoding.TextUnmarshaler
 	} = &SceneRef{}
 )
 
@@ -38,14 +41,17 @@ type scener interface {
 	Hider
 	Identifier
 	Scanner
+	Scoper
 }
 
 func init() {
-	gob.Register(&Scene{})
-	gob.Register(&SceneRef{})
+	RegisterType(&Scene{})
+	RegisterType(&SceneRef{})
 }
 
 // Scene is a component for adding an identity, bounds, and other properties.
+// Scene is also a Scoper, so IDs of components within the scene only need to
+// be unique within the scene.
 type Scene struct {
 	ID
 	Bounds // world coordinates
@@ -59,10 +65,14 @@ func (s *Scene) Scan(visit VisitFunc) error {
 	return visit(s.Child)
 }
 
+// ScopesIdentifiers is present so Scene is recognised as a Scoper.
+func (Scene) ScopesIdentifiers() {}
+
 func (s *Scene) String() string { return "Scene" }
 
-// SceneRef loads a gzipped, gob-encoded Scene from the asset FS.
-// After Load, Scene is usable.
+// SceneRef loads a Scene from the asset FS. Files with the TextExt extension
+// are in the text format (see LoadText), and other files are gzipped gob (see
+// LoadGobz). After Load, Scene is usable.
 // This is mostly useful for scenes that refer to other scenes, e.g.
 //
 //    sc := &Scene{
@@ -73,9 +83,12 @@ func (s *Scene) String() string { return "Scene" }
 type SceneRef struct {
 	Path string
 
-	*Scene // not gob encoded
+	*Scene // not encoded
 }
 
+// TextExt is the file extension for scenes in the text format.
+const TextExt = ".json"
+
 // GobDecode saves the byte slice as Path.
 func (r *SceneRef) GobDecode(b []byte) error {
 	r.Path = string(b)
@@ -87,19 +100,81 @@ func (r *SceneRef) GobEncode() ([]byte, error) {
 	return []byte(r.Path), nil
 }
 
+// MarshalText returns Path as a byte slice.
+func (r *SceneRef) MarshalText() ([]byte, error) { return r.GobEncode() }
+
+// UnmarshalText saves the byte slice as Path.
+func (r *SceneRef) UnmarshalText(b []byte) error { return r.GobDecode(b) }
+
+// loadScene loads a scene from a file, choosing the codec by file extension.
+func loadScene(sc *Scene, assets fs.FS, path string) error {
+	if strings.HasSuffix(path, TextExt) {
+		return LoadText(sc, assets, path)
+	}
+	return LoadGobz(sc, assets, path)
+}
+
 // Load loads the scene from the file.
 func (r *SceneRef) Load(assets fs.FS) error {
 	sc := new(Scene)
-	if err := LoadGobz(sc, assets, r.Path); err != nil {
+	if err := loadScene(sc, assets, r.Path); err != nil {
 		return err
 	}
 	r.Scene = sc
 	return nil
 }
 
-// Save saves the scene to a file in the current directory.
-func (r *SceneRef) Save() error {
-	return SaveGobz(r.Scene, filepath.Base(r.Path))
+// AssetPath returns r.Path.
+func (r *SceneRef) AssetPath() string { return r.Path }
+
+// Reload loads the scene from the file again, and replaces the current scene
+// (and everything in it) in place: the old scene is unregistered, and the new
+// scene is registered under the same parent and prepared. The new scene is
+// loaded fully first, so if loading fails, the old scene is left alone. Whether
+// the scene is disabled or hidden is preserved.
+func (r *SceneRef) Reload(game *Game, assets fs.FS) error {
+	sc := new(Scene)
+	if err := loadScene(sc, assets, r.Path); err != nil {
+		return err
+	}
+	if err := game.Load(sc, assets); err != nil {
+		return err
+	}
+	return replaceScene(game, r, &r.Scene, sc)
+}
+
+// replaceScene replaces the scene *cur of a registered ref component (such as
+// a SceneRef) with sc (which should already be loaded), by unregistering ref,
+// changing *cur, then registering and preparing ref again. Whether the scene
+// is disabled or hidden is preserved.
+func replaceScene(game *Game, ref any, cur **Scene, sc *Scene) error {
+	if *cur != nil {
+		sc.Disables, sc.Hides = (*cur).Disables, (*cur).Hides
+	}
+	parent := game.Parent(ref)
+	game.PathUnregister(ref)
+	*cur = sc
+	if err := game.PathRegister(ref, parent); err != nil {
+		return err
+	}
+	return game.Prepare(ref)
+}
+
+// Scan visits r.Scene.Child, if the scene has been loaded.
+func (r *SceneRef) Scan(visit VisitFunc) error {
+	if r.Scene == nil {
+		return nil
+	}
+	return r.Scene.Scan(visit)
+}
+
+// Save saves the scene to r.Path in dst, so that it can be loaded again from
+// the same path. The codec is chosen by file extension, as for Load.
+func (r *SceneRef) Save(dst WriteFS) error {
+	if strings.HasSuffix(r.Path, TextExt) {
+		return SaveText(r.Scene, dst, r.Path)
+	}
+	return SaveGobz(r.Scene, dst, r.Path)
 }
 
 func (r *SceneRef) String() string { return "SceneRef{" + r.Path + "}" }
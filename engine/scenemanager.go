@@ -0,0 +1,360 @@
+/*
+Copyright 2021 Josh Deprez
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"sync"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// Ensure SceneManager satisfies interfaces.
+var _ interface {
+	Disposer
+	DrawManager
+	Identifier
+	Loader
+	Prepper
+	Scanner
+	Updater
+} = &SceneManager{}
+
+func init() {
+	RegisterType(&SceneManager{})
+}
+
+// StackedScene is the interface needed for scenes managed by a SceneManager
+// (e.g. *Scene or *SceneRef).
+type StackedScene interface {
+	Disabler
+	Hider
+}
+
+// SceneEntry is one scene in a SceneManager's stack.
+type SceneEntry struct {
+	Scene   StackedScene
+	Overlay bool // scenes below an overlay remain visible (but disabled)
+}
+
+// SceneManager manages a stack of scenes (e.g. level, then pause menu on top,
+// then options menu on top of that). Only the top scene is enabled. Scenes
+// below the top are hidden, unless every scene above them is an overlay.
+//
+// Push, PushOverlay, Pop, and Replace are queued and carried out one at a time
+// by Update. Each change can use a Transition: the transition covers the
+// screen, the stack changes, and then the transition uncovers the screen.
+// Scenes being pushed are loaded in the background (while the screen is being
+// covered, and for as long after as needed), using the assets passed to Load.
+//
+// SceneManager draws the visible scenes itself, bottom to top, followed by
+// any transition in progress, so it is a DrawManager. Transitions draw over
+// the whole screen, so SceneManager works best as the Game's Root, or under
+// a DrawDFS.
+type SceneManager struct {
+	ID
+	Disables
+	Hides
+	Stack []SceneEntry // bottom to top
+
+	game   *Game
+	assets fs.FS
+
+	mu      sync.Mutex // guards Stack, queue, and the loading fields
+	queue   []*sceneOp // changes yet to start
+	op      *sceneOp   // change in progress
+	phase   scenePhase // of op
+	ticks   int        // in phase
+	cancel  context.CancelFunc
+	loaded  bool // op.push is loaded, registered, and prepared
+	loadErr error
+}
+
+// sceneOp is a queued change to the stack.
+type sceneOp struct {
+	pop        bool         // remove the top scene
+	push       StackedScene // then add this scene (if not nil)
+	overlay    bool
+	transition Transition
+}
+
+type scenePhase int
+
+const (
+	phaseCover scenePhase = iota
+	phaseUncover
+)
+
+// Push queues a scene to be pushed onto the stack, using the transition t
+// (which may be nil, for an instant change).
+func (m *SceneManager) Push(scene StackedScene, t Transition) {
+	m.enqueue(&sceneOp{push: scene, transition: t})
+}
+
+// PushOverlay is like Push, but the scenes underneath remain visible.
+func (m *SceneManager) PushOverlay(scene StackedScene, t Transition) {
+	m.enqueue(&sceneOp{push: scene, overlay: true, transition: t})
+}
+
+// Pop queues removing (and unregistering) the top scene, using the
+// transition t (which may be nil, for an instant change).
+func (m *SceneManager) Pop(t Transition) {
+	m.enqueue(&sceneOp{pop: true, transition: t})
+}
+
+// Replace queues replacing the top scene with another, using the transition
+// t (which may be nil, for an instant change). If the new scene fails to load,
+// the top scene is kept.
+func (m *SceneManager) Replace(scene StackedScene, t Transition) {
+	m.enqueue(&sceneOp{pop: true, push: scene, transition: t})
+}
+
+func (m *SceneManager) enqueue(op *sceneOp) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.queue = append(m.queue, op)
+}
+
+// Top returns the top scene, or nil if the stack is empty.
+func (m *SceneManager) Top() StackedScene {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.Stack) == 0 {
+		return nil
+	}
+	return m.Stack[len(m.Stack)-1].Scene
+}
+
+// Busy reports whether any changes are in progress or queued.
+func (m *SceneManager) Busy() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.op != nil || len(m.queue) > 0
+}
+
+// Covered returns how much of the screen the current transition covers, from
+// 0 (none of it) to 1 (all of it).
+func (m *SceneManager) Covered() float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.covered()
+}
+
+func (m *SceneManager) covered() float64 {
+	if m.op == nil {
+		return 0
+	}
+	n := transitionTicks(m.op.transition)
+	if n == 0 {
+		return 0
+	}
+	if m.phase == phaseCover {
+		return float64(m.ticks) / float64(n)
+	}
+	return 1 - float64(m.ticks)/float64(n)
+}
+
+// Load stores a copy of assets for loading pushed scenes later.
+func (m *SceneManager) Load(assets fs.FS) error {
+	m.assets = assets
+	return nil
+}
+
+// Prepare stores a reference to the game, and enables and shows the scenes
+// in the stack as appropriate.
+func (m *SceneManager) Prepare(game *Game) error {
+	m.game = game
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.restack()
+	return nil
+}
+
+// Scan visits each scene in the stack, and the scene being pushed, if it has
+// been loaded.
+func (m *SceneManager) Scan(visit VisitFunc) error {
+	m.mu.Lock()
+	scenes := make([]any, 0, len(m.Stack)+1)
+	for _, e := range m.Stack {
+		scenes = append(scenes, e.Scene)
+	}
+	if m.op != nil && m.op.push != nil && m.loaded && m.loadErr == nil {
+		scenes = append(scenes, m.op.push)
+	}
+	m.mu.Unlock()
+	return visit.Many(scenes...)
+}
+
+// Dispose cancels loading any scene being pushed.
+func (m *SceneManager) Dispose() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.cancel != nil {
+		m.cancel()
+	}
+}
+
+// Draw draws the visible scenes, bottom to top, and then the transition.
+func (m *SceneManager) Draw(screen *ebiten.Image, opts *ebiten.DrawImageOptions) {
+	m.mu.Lock()
+	var scenes []StackedScene
+	for _, e := range m.Stack {
+		if !e.Scene.Hidden() {
+			scenes = append(scenes, e.Scene)
+		}
+	}
+	var t Transition
+	if m.op != nil {
+		t = m.op.transition
+	}
+	amount := m.covered()
+	m.mu.Unlock()
+
+	for _, sc := range scenes {
+		drawSubtree(m.game, sc, screen, opts)
+	}
+	if t != nil && amount > 0 {
+		t.Cover(screen, amount)
+	}
+}
+
+// ManagesDrawingSubcomponents is present so SceneManager is recognised as a
+// DrawManager.
+func (m *SceneManager) ManagesDrawingSubcomponents() {}
+
+// Update advances the change in progress, or starts the next queued change.
+func (m *SceneManager) Update() error {
+	// Unregistering takes the database lock, and registering calls Scan
+	// (which takes m.mu) while holding it, so unregister after unlocking.
+	// Pushed scenes are registered with PathRegister, so Registrars above m
+	// (e.g. a DrawDAG) need to be told when they are popped.
+	if popped := m.advance(); popped != nil {
+		m.game.PathUnregister(popped)
+	}
+	return nil
+}
+
+// advance advances the change in progress, or starts the next queued change.
+// It returns a scene that was popped and needs to be unregistered, if any.
+func (m *SceneManager) advance() (popped StackedScene) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.op == nil {
+		if len(m.queue) == 0 {
+			return nil
+		}
+		m.op, m.queue = m.queue[0], m.queue[1:]
+		m.phase, m.ticks = phaseCover, 0
+		m.startLoad()
+	}
+
+	n := transitionTicks(m.op.transition)
+	switch m.phase {
+	case phaseCover:
+		if m.ticks < n {
+			m.ticks++
+		}
+		if m.ticks < n || !m.loaded {
+			return nil
+		}
+		if m.loadErr != nil {
+			// Keep the stack as it was.
+			if !errors.Is(m.loadErr, context.Canceled) {
+				m.game.Log(LevelError, "SceneManager: couldn't load scene", F("err", m.loadErr))
+			}
+		} else {
+			popped = m.swap()
+		}
+		m.phase, m.ticks = phaseUncover, 0
+		if n > 0 {
+			return popped
+		}
+		fallthrough
+
+	case phaseUncover:
+		if m.ticks < n {
+			m.ticks++
+		}
+		if m.ticks >= n {
+			m.op, m.loaded, m.loadErr, m.cancel = nil, false, nil, nil
+		}
+	}
+	return popped
+}
+
+// startLoad begins loading m.op.push in the background. m.mu must be held.
+func (m *SceneManager) startLoad() {
+	m.loaded, m.loadErr = false, nil
+	if m.op.push == nil {
+		m.loaded = true
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	m.cancel = cancel
+	m.game.loadInBackground(ctx, m.op.push, m, m.assets, nil, func(_ LoadStats, err error) {
+		if errors.Is(err, context.Canceled) {
+			m.game.Log(LevelInfo, "SceneManager: cancelled")
+		}
+		// A cancelled load counts as failed, so that the change still
+		// finishes (leaving the stack as it was).
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.loaded, m.loadErr = true, err
+	})
+}
+
+// swap applies m.op to the stack, and returns the scene that was popped (if
+// any), which the caller must unregister after unlocking m.mu. m.mu must be
+// held.
+func (m *SceneManager) swap() (popped StackedScene) {
+	if m.op.pop && len(m.Stack) > 0 {
+		popped = m.Stack[len(m.Stack)-1].Scene
+		m.Stack = m.Stack[:len(m.Stack)-1]
+	}
+	if m.op.push != nil {
+		m.Stack = append(m.Stack, SceneEntry{
+			Scene:   m.op.push,
+			Overlay: m.op.overlay,
+		})
+	}
+	m.restack()
+	return popped
+}
+
+// restack enables the top scene and disables the rest, and shows each scene
+// that isn't covered by a non-overlay scene. m.mu must be held.
+func (m *SceneManager) restack() {
+	visible := true
+	for i := len(m.Stack) - 1; i >= 0; i-- {
+		e := m.Stack[i]
+		if i == len(m.Stack)-1 {
+			e.Scene.Enable()
+		} else {
+			e.Scene.Disable()
+		}
+		if visible {
+			e.Scene.Show()
+		} else {
+			e.Scene.Hide()
+		}
+		visible = visible && e.Overlay
+	}
+}
+
+func (m *SceneManager) String() string { return "SceneManager" }
@@ -0,0 +1,265 @@
+/*
+Copyright 2021 Josh Deprez
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import (
+	"image"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+type sceneState struct {
+	disabled, hidden bool
+}
+
+func stateOf(s *Scene) sceneState {
+	return sceneState{s.Disabled(), s.Hidden()}
+}
+
+// settle updates g until all changes to m are complete, and returns the
+// number of updates that took.
+func settle(t *testing.T, g *Game, m *SceneManager) int {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	n := 0
+	for m.Busy() {
+		if time.Now().After(deadline) {
+			t.Fatalf("SceneManager still busy after %d updates", n)
+		}
+		if err := g.Update(); err != nil {
+			t.Fatalf("g.Update() = %v", err)
+		}
+		n++
+		time.Sleep(time.Millisecond)
+	}
+	return n
+}
+
+func TestSceneManagerStack(t *testing.T) {
+	level1 := &Scene{ID: "level1", Child: MakeContainer()}
+	level2 := &Scene{ID: "level2", Child: MakeContainer()}
+	pause := &Scene{ID: "pause", Child: MakeContainer()}
+	options := &Scene{ID: "options", Child: MakeContainer()}
+	m := &SceneManager{Stack: []SceneEntry{{Scene: level1}}}
+	g := &Game{
+		ScreenSize: image.Pt(320, 240),
+		Root:       m,
+	}
+	if err := g.LoadAndPrepare(fstest.MapFS{}); err != nil {
+		t.Fatalf("LoadAndPrepare() = %v", err)
+	}
+	if got, want := stateOf(level1), (sceneState{}); got != want {
+		t.Errorf("level1 state = %+v, want %+v", got, want)
+	}
+
+	m.PushOverlay(pause, nil)
+	settle(t, g, m)
+	if got := m.Top(); got != pause {
+		t.Errorf("m.Top() = %v, want pause", got)
+	}
+	if got, want := g.Parent(pause), any(m); got != want {
+		t.Errorf("g.Parent(pause) = %v, want %v", got, want)
+	}
+	if got, want := stateOf(level1), (sceneState{disabled: true}); got != want {
+		t.Errorf("level1 state = %+v, want %+v", got, want)
+	}
+	if got, want := stateOf(pause), (sceneState{}); got != want {
+		t.Errorf("pause state = %+v, want %+v", got, want)
+	}
+
+	m.Push(options, nil)
+	settle(t, g, m)
+	for _, test := range []struct {
+		name  string
+		scene *Scene
+		want  sceneState
+	}{
+		{"level1", level1, sceneState{disabled: true, hidden: true}},
+		{"pause", pause, sceneState{disabled: true, hidden: true}},
+		{"options", options, sceneState{}},
+	} {
+		if got := stateOf(test.scene); got != test.want {
+			t.Errorf("%s state = %+v, want %+v", test.name, got, test.want)
+		}
+	}
+
+	m.Pop(nil)
+	m.Pop(nil)
+	settle(t, g, m)
+	if got := m.Top(); got != level1 {
+		t.Errorf("m.Top() = %v, want level1", got)
+	}
+	if got := g.Parent(pause); got != nil {
+		t.Errorf("g.Parent(pause) = %v, want nil", got)
+	}
+	if got := g.Parent(options); got != nil {
+		t.Errorf("g.Parent(options) = %v, want nil", got)
+	}
+	if got, want := stateOf(level1), (sceneState{}); got != want {
+		t.Errorf("level1 state = %+v, want %+v", got, want)
+	}
+
+	m.Replace(level2, &Fade{Duration: 3})
+	var covered []float64
+	for m.Busy() {
+		if err := g.Update(); err != nil {
+			t.Fatalf("g.Update() = %v", err)
+		}
+		c := m.Covered()
+		if len(covered) > 0 && c == 1 && covered[len(covered)-1] == 1 {
+			// Waiting for loading to finish.
+			time.Sleep(time.Millisecond)
+			continue
+		}
+		covered = append(covered, c)
+		if m.Top() == level1 && c == 1 && stateOf(level1) != (sceneState{}) {
+			t.Errorf("level1 state during cover = %+v, want enabled and shown", stateOf(level1))
+		}
+	}
+	wantCovered := []float64{1. / 3, 2. / 3, 1, 2. / 3, 1. / 3, 0}
+	if len(covered) != len(wantCovered) {
+		t.Fatalf("covered = %v, want %v", covered, wantCovered)
+	}
+	for i := range covered {
+		if d := covered[i] - wantCovered[i]; d > 1e-9 || d < -1e-9 {
+			t.Fatalf("covered = %v, want %v", covered, wantCovered)
+		}
+	}
+	if got := m.Top(); got != level2 {
+		t.Errorf("m.Top() = %v, want level2", got)
+	}
+	if got := g.Parent(level1); got != nil {
+		t.Errorf("g.Parent(level1) = %v, want nil", got)
+	}
+	if got, want := stateOf(level2), (sceneState{}); got != want {
+		t.Errorf("level2 state = %+v, want %+v", got, want)
+	}
+}
+
+func TestSceneManagerLoadFailure(t *testing.T) {
+	level := &Scene{ID: "level", Child: MakeContainer()}
+	m := &SceneManager{Stack: []SceneEntry{{Scene: level}}}
+	g := &Game{
+		ScreenSize: image.Pt(320, 240),
+		Root:       m,
+	}
+	if err := g.LoadAndPrepare(fstest.MapFS{}); err != nil {
+		t.Fatalf("LoadAndPrepare() = %v", err)
+	}
+
+	m.Replace(&SceneRef{Path: "missing.gob.gz"}, &Wipe{Duration: 2})
+	settle(t, g, m)
+	if got := m.Top(); got != level {
+		t.Errorf("m.Top() = %v, want level", got)
+	}
+	if got, want := stateOf(level), (sceneState{}); got != want {
+		t.Errorf("level state = %+v, want %+v", got, want)
+	}
+}
+
+func TestWipeRect(t *testing.T) {
+	bounds := image.Rect(0, 0, 100, 50)
+	tests := []struct {
+		dir    WipeDirection
+		amount float64
+		want   image.Rectangle
+	}{
+		{WipeRight, 0, image.Rect(0, 0, 0, 50)},
+		{WipeRight, 0.25, image.Rect(0, 0, 25, 50)},
+		{WipeLeft, 0.25, image.Rect(75, 0, 100, 50)},
+		{WipeDown, 0.5, image.Rect(0, 0, 100, 25)},
+		{WipeUp, 0.5, image.Rect(0, 25, 100, 50)},
+		{WipeUp, 1, bounds},
+	}
+	for _, test := range tests {
+		if got := wipeRect(bounds, test.dir, test.amount); got != test.want {
+			t.Errorf("wipeRect(%v, %v, %v) = %v, want %v", bounds, test.dir, test.amount, got, test.want)
+		}
+	}
+}
+
+func TestIrisRadius(t *testing.T) {
+	bounds := image.Rect(0, 0, 60, 80)
+	tests := []struct {
+		focus  image.Point
+		amount float64
+		want   float64
+	}{
+		{image.Pt(30, 40), 0, 50},
+		{image.Pt(30, 40), 0.5, 25},
+		{image.Pt(30, 40), 1, 0},
+		{image.Pt(0, 0), 0, 100},
+	}
+	for _, test := range tests {
+		if got := irisRadius(bounds, test.focus, test.amount); got != test.want {
+			t.Errorf("irisRadius(%v, %v, %v) = %v, want %v", bounds, test.focus, test.amount, got, test.want)
+		}
+	}
+}
+
+func TestSceneManagerPathRegister(t *testing.T) {
+	m := &SceneManager{}
+	reg := &fakeRegistrar{child: m, seen: make(map[any]bool)}
+	g := &Game{
+		ScreenSize: image.Pt(320, 240),
+		Root:       &DrawDFS{Child: reg},
+	}
+	if err := g.LoadAndPrepare(fstest.MapFS{}); err != nil {
+		t.Fatalf("LoadAndPrepare() = %v", err)
+	}
+
+	level := &Scene{ID: "level", Child: MakeContainer()}
+	m.Push(level, nil)
+	settle(t, g, m)
+	if !reg.seen[level] {
+		t.Error("after Push, registrar above m wasn't told about level")
+	}
+	m.Pop(nil)
+	settle(t, g, m)
+	if reg.seen[level] {
+		t.Error("after Pop, registrar above m still has level")
+	}
+}
+
+func TestSceneManagerCancelledLoad(t *testing.T) {
+	assets := gatedFS{
+		FS: fstest.MapFS{
+			"level.gobz": {Data: gobz(t, &Scene{ID: "level", Child: MakeContainer()})},
+		},
+		gate: make(chan struct{}),
+	}
+	m := &SceneManager{}
+	g := &Game{
+		ScreenSize: image.Pt(320, 240),
+		Root:       m,
+	}
+	if err := g.LoadAndPrepare(assets); err != nil {
+		t.Fatalf("LoadAndPrepare() = %v", err)
+	}
+
+	m.Push(&SceneRef{Path: "level.gobz"}, nil)
+	if err := g.Update(); err != nil {
+		t.Fatalf("g.Update() = %v", err)
+	}
+	m.Dispose() // cancels the load, which is stuck opening the file
+	close(assets.gate)
+	settle(t, g, m)
+	if got := m.Top(); got != nil {
+		t.Errorf("m.Top() after cancelled push = %v, want nil", got)
+	}
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2022 Josh Deprez
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import "strings"
+
+// Lookup returns the component at the given path, or nil if there is none.
+// A path is a sequence of IDs separated by "/". The first ID is looked up in
+// the game's top-level scope, and each subsequent ID is looked up in the scope
+// of the component found by the previous one. For example,
+// Lookup("level_1/hexagons") finds the component with ID "hexagons" inside the
+// scope of the Scene with ID "level_1". A leading "/" is ignored.
+func (g *Game) Lookup(path string) Identifier {
+	g.dbmu.RLock()
+	defer g.dbmu.RUnlock()
+	return g.lookupPath(g, strings.TrimPrefix(path, "/"))
+}
+
+// LookupFrom returns the component at the given path relative to the
+// component from, or nil if there is none. The first ID in the path is
+// looked up in the scope containing from (or the scope of from itself, if it
+// is a Scoper), then in each enclosing scope in turn, until it is found. The
+// rest of the path is resolved as for Lookup. A path beginning with "/" is
+// treated as an absolute path (as for Lookup).
+//
+// For example, a component in a level Scene can find a camera with ID
+// "game_camera", whether the camera is in the same Scene or outside it.
+func (g *Game) LookupFrom(from any, path string) Identifier {
+	if strings.HasPrefix(path, "/") {
+		return g.Lookup(path)
+	}
+	g.dbmu.RLock()
+	defer g.dbmu.RUnlock()
+	first, rest, _ := strings.Cut(path, "/")
+	scope := from
+	if _, ok := from.(Scoper); !ok {
+		scope = g.scopeOf(g.parent[from])
+	}
+	for {
+		if c := g.scopes[scope][first]; c != nil {
+			if rest == "" {
+				return c
+			}
+			return g.lookupPath(c, rest)
+		}
+		if scope == g {
+			return nil
+		}
+		scope = g.scopeOf(g.parent[scope])
+	}
+}
+
+// lookupPath resolves path starting in the given scope. The caller must hold
+// g.dbmu.
+func (g *Game) lookupPath(scope any, path string) Identifier {
+	var c Identifier
+	for _, id := range strings.Split(path, "/") {
+		c = g.scopes[scope][id]
+		if c == nil {
+			return nil
+		}
+		scope = c
+	}
+	return c
+}
+
+// scopeOf returns the nearest Scoper at or above c, or g if there is none.
+// The caller must hold g.dbmu.
+func (g *Game) scopeOf(c any) any {
+	for p := c; p != nil; p = g.parent[p] {
+		if _, ok := p.(Scoper); ok {
+			return p
+		}
+	}
+	return g
+}
@@ -17,23 +17,43 @@ limitations under the License.
 package engine
 
 import (
+	"context"
+	"fmt"
 	"image"
+	"io/fs"
+	"sort"
 
 	"github.com/DrJosh9000/ichigo/geom"
 	"github.com/hajimehoshi/ebiten/v2"
 )
 
 var _ interface {
+	ContextLoader
+	Loader
 	Prepper
 	Scanner
+	Validator
 } = &Sheet{}
 
 // Sheet handles images that consist of a grid of equally sized regions
 // (cells) and can produce subimages for the cell at an index. This is useful
 // for various applications such as sprite animation and tile maps. Additionally
 // each sheet carries a collection of animations that use the sheet.
+//
+// If Aseprite is set, CellSize, AnimDefs, and (if empty) Src.Path are filled
+// in from the Aseprite data when the sheet is loaded.
+//
+// If Atlas is set, cells are frames in a texture atlas instead of a grid.
+// Frames can vary in size, be trimmed, and have pivots, so they should be
+// drawn with DrawCell. Src.Path and CellSize are filled in from the atlas when
+// the sheet is loaded.
+//
+// Aseprite and Atlas cannot both be set, since Aseprite animations index grid
+// cells rather than atlas frames.
 type Sheet struct {
 	AnimDefs map[string]*AnimDef
+	Aseprite *AsepriteRef
+	Atlas    *AtlasRef
 	CellSize image.Point
 	Src      ImageRef
 
@@ -55,8 +75,48 @@ func (s *Sheet) NewAnims() map[string]*Anim {
 	return m
 }
 
-// Prepare computes the width of the image (in cells).
-func (s *Sheet) Prepare(*Game) error {
+// Load loads the sheet without a cache (see LoadContext).
+func (s *Sheet) Load(assets fs.FS) error {
+	return s.LoadContext(context.Background(), assets)
+}
+
+// LoadContext loads s.Aseprite or s.Atlas (if set) and applies it to the
+// sheet. This happens before s.Src is loaded.
+func (s *Sheet) LoadContext(ctx context.Context, assets fs.FS) error {
+	if err := s.checkSources(); err != nil {
+		return err
+	}
+	if s.Aseprite != nil {
+		if err := s.Aseprite.Load(assets); err != nil {
+			return err
+		}
+		s.Aseprite.apply(s)
+	}
+	if s.Atlas != nil {
+		if err := s.Atlas.LoadContext(ctx, assets); err != nil {
+			return err
+		}
+		s.Atlas.apply(s)
+	}
+	return nil
+}
+
+// Prepare converts the Time of each anim step (where set) into a Duration in
+// game steps, and computes the width of the image (in cells).
+func (s *Sheet) Prepare(game *Game) error {
+	for _, d := range s.AnimDefs {
+		if d == nil {
+			continue
+		}
+		for i, st := range d.Steps {
+			if st.Time > 0 {
+				d.Steps[i].Duration = game.stepsFor(st.Time)
+			}
+		}
+	}
+	if s.Atlas != nil {
+		return nil
+	}
 	s.w, _ = s.Src.Image().Size()
 	s.w /= s.CellSize.X
 	return nil
@@ -67,11 +127,110 @@ func (s *Sheet) Scan(visit VisitFunc) error {
 	return visit(&s.Src)
 }
 
+// Validate checks that at most one of s.Aseprite and s.Atlas is set, validates
+// it, and checks that CellSize is positive in both dimensions. For atlas
+// sheets (once loaded), it also checks that every anim step refers to a frame
+// in the atlas.
+func (s *Sheet) Validate(game *Game, assets fs.FS) error {
+	if err := s.checkSources(); err != nil {
+		return err
+	}
+	if s.Aseprite != nil {
+		if err := s.Aseprite.Validate(game, assets); err != nil {
+			return err
+		}
+	}
+	if s.Atlas != nil {
+		if err := s.Atlas.Validate(game, assets); err != nil {
+			return err
+		}
+		if err := s.checkAtlasCells(); err != nil {
+			return err
+		}
+	}
+	if s.CellSize.X <= 0 || s.CellSize.Y <= 0 {
+		return fmt.Errorf("CellSize = %v, must be positive", s.CellSize)
+	}
+	return nil
+}
+
+// checkSources reports an error if both s.Aseprite and s.Atlas are set.
+func (s *Sheet) checkSources() error {
+	if s.Aseprite != nil && s.Atlas != nil {
+		return fmt.Errorf("Aseprite (%q) and Atlas (%q) are both set, must be at most one", s.Aseprite.Path, s.Atlas.Path)
+	}
+	return nil
+}
+
+// checkAtlasCells reports an error if any anim step refers to a cell that is
+// not a frame in s.Atlas.
+func (s *Sheet) checkAtlasCells() error {
+	keys := make([]string, 0, len(s.AnimDefs))
+	for k := range s.AnimDefs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		d := s.AnimDefs[k]
+		if d == nil {
+			continue
+		}
+		for i, st := range d.Steps {
+			if _, ok := s.Atlas.Frame(st.Cell); !ok {
+				return fmt.Errorf("anim %q step %d: cell %d is not a frame in %s", k, i, st.Cell, s.Atlas.Path)
+			}
+		}
+	}
+	return nil
+}
+
 // SubImage returns an *ebiten.Image corresponding to the given cell index.
+// For atlas sheets, the image may be trimmed (see CellOffset), and is empty if
+// the atlas has no frame i.
 func (s *Sheet) SubImage(i int) *ebiten.Image {
+	if s.Atlas != nil {
+		f, _ := s.Atlas.Frame(i)
+		return s.Src.Image().SubImage(f.Rect).(*ebiten.Image)
+	}
 	p := geom.CMul(image.Pt(i%s.w, i/s.w), s.CellSize)
 	r := image.Rectangle{p, p.Add(s.CellSize)}
 	return s.Src.Image().SubImage(r).(*ebiten.Image)
 }
 
+// CellOffset returns where to draw the SubImage for cell i, relative to the
+// origin. For grid sheets this is always (0, 0). For atlas sheets it
+// accounts for trimming and the frame's pivot.
+func (s *Sheet) CellOffset(i int) image.Point {
+	if s.Atlas == nil {
+		return image.Point{}
+	}
+	f, _ := s.Atlas.Frame(i)
+	return f.Offset.Sub(f.Pivot)
+}
+
+// CellIndex returns the index of the cell with the given name. Only atlas
+// sheets have named cells.
+func (s *Sheet) CellIndex(name string) (int, bool) {
+	if s.Atlas == nil {
+		return 0, false
+	}
+	return s.Atlas.Index(name)
+}
+
+// DrawCell draws cell i to dst, offset by CellOffset(i).
+func (s *Sheet) DrawCell(dst *ebiten.Image, i int, opts *ebiten.DrawImageOptions) {
+	off := s.CellOffset(i)
+	if off == (image.Point{}) {
+		dst.DrawImage(s.SubImage(i), opts)
+		return
+	}
+	og := opts.GeoM
+	var mat ebiten.GeoM
+	mat.Translate(geom.CFloat(off))
+	mat.Concat(og)
+	opts.GeoM = mat
+	dst.DrawImage(s.SubImage(i), opts)
+	opts.GeoM = og
+}
+
 func (s *Sheet) String() string { return "Sheet" }
@@ -16,16 +16,12 @@ limitations under the License.
 
 package engine
 
-import (
-	"encoding/gob"
-
-	"github.com/DrJosh9000/ichigo/geom"
-)
+import "github.com/DrJosh9000/ichigo/geom"
 
 var _ Collider = SolidRect{}
 
 func init() {
-	gob.Register(&SolidRect{})
+	RegisterType(&SolidRect{})
 }
 
 // SolidRect is a minimal implementation of a Collider defined by a single Box.
@@ -17,7 +17,6 @@ limitations under the License.
 package engine
 
 import (
-	"encoding/gob"
 	"fmt"
 	"image"
 
@@ -35,7 +34,7 @@ var _ interface {
 } = &Sprite{}
 
 func init() {
-	gob.Register(&Sprite{})
+	RegisterType(&Sprite{})
 }
 
 // Sprite combines an Actor with the ability to Draw from a single spritesheet.
@@ -43,7 +42,8 @@ type Sprite struct {
 	Actor      Actor
 	DrawOffset image.Point
 	Hides
-	Sheet Sheet
+	Sheet  Sheet
+	Sounds []*SoundEmitter // sounds emitted from the sprite's position
 
 	anim *Anim
 }
@@ -53,12 +53,20 @@ func (s *Sprite) BoundingBox() geom.Box { return s.Actor.BoundingBox() }
 
 // Draw draws the current cell to the screen.
 func (s *Sprite) Draw(screen *ebiten.Image, opts *ebiten.DrawImageOptions) {
-	screen.DrawImage(s.Sheet.SubImage(s.anim.Cell()), opts)
+	s.Sheet.DrawCell(screen, s.anim.Cell(), opts)
 }
 
-// Scan visits &s.Actor and &s.Sheet.
+// Scan visits &s.Actor, &s.Sheet, and each of s.Sounds.
 func (s *Sprite) Scan(visit VisitFunc) error {
-	return visit.Many(&s.Actor, &s.Sheet)
+	if err := visit.Many(&s.Actor, &s.Sheet); err != nil {
+		return err
+	}
+	for _, e := range s.Sounds {
+		if err := visit(e); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // Anim returns the current Anim.
@@ -0,0 +1,265 @@
+/*
+Copyright 2021 Josh Deprez
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io/fs"
+	"math"
+)
+
+// Ensure WorldStream satisfies interfaces.
+var _ interface {
+	Disabler
+	Disposer
+	Hider
+	Identifier
+	Loader
+	Prepper
+	Scanner
+	Updater
+	Validator
+} = &WorldStream{}
+
+func init() {
+	RegisterType(&WorldStream{})
+}
+
+// WorldStream divides a large world into regions, each a scene, and keeps
+// only the regions near a camera registered. As the camera approaches a
+// region, the region is loaded in the background, then registered (with
+// PathRegister, so that e.g. a DrawDAG above the WorldStream sees it) and
+// prepared. Regions that fall far behind the camera are unregistered and
+// released.
+//
+// A region is loaded once it is within LoadMargin of the camera's view, and
+// is not unloaded until it is further than UnloadMargin away. Keeping
+// UnloadMargin larger than LoadMargin prevents regions near the boundary being
+// loaded and unloaded repeatedly as the camera moves back and forth.
+type WorldStream struct {
+	ID
+	Disables
+	Hides
+	CameraID     string
+	Regions      []*StreamRegion
+	LoadMargin   int // world pixels beyond the camera view
+	UnloadMargin int // world pixels beyond the camera view; >= LoadMargin
+
+	game   *Game
+	assets fs.FS
+	camera *Camera
+}
+
+// StreamRegion is one region of a WorldStream.
+type StreamRegion struct {
+	Bounds image.Rectangle // in the same coordinates as Camera.Centre
+	Scene  *SceneRef
+
+	state  regionState
+	cancel context.CancelFunc
+}
+
+type regionState int
+
+const (
+	regionUnloaded regionState = iota
+	regionLoading
+	regionCancelling // abandoned while loading; waiting for the load to end
+	regionLoaded
+	regionFailed // not retried until the camera moves away
+)
+
+// Loaded reports whether the region is loaded and registered.
+func (r *StreamRegion) Loaded() bool { return r.state == regionLoaded }
+
+// Load stores a copy of assets for loading regions later. Regions are not
+// loaded at this point.
+func (w *WorldStream) Load(assets fs.FS) error {
+	w.assets = assets
+	return nil
+}
+
+// Prepare stores a reference to the game and obtains a reference to the
+// camera.
+func (w *WorldStream) Prepare(game *Game) error {
+	w.game = game
+	c, err := w.findCamera(game)
+	if err != nil {
+		return err
+	}
+	w.camera = c
+	return nil
+}
+
+// Validate checks that CameraID refers to a *Camera, that each region has a
+// scene, and that the margins make sense.
+func (w *WorldStream) Validate(game *Game, _ fs.FS) error {
+	if _, err := w.findCamera(game); err != nil {
+		return err
+	}
+	if w.UnloadMargin < w.LoadMargin {
+		return fmt.Errorf("UnloadMargin %d < LoadMargin %d", w.UnloadMargin, w.LoadMargin)
+	}
+	for i, r := range w.Regions {
+		if r == nil || r.Scene == nil {
+			return fmt.Errorf("region %d has no scene", i)
+		}
+	}
+	return nil
+}
+
+func (w *WorldStream) findCamera(game *Game) (*Camera, error) {
+	c, ok := game.LookupFrom(w, w.CameraID).(*Camera)
+	if !ok {
+		return nil, fmt.Errorf("component %q type != *Camera", w.CameraID)
+	}
+	return c, nil
+}
+
+// Scan visits the scene of each loaded region.
+func (w *WorldStream) Scan(visit VisitFunc) error {
+	for _, r := range w.Regions {
+		if r.state != regionLoaded {
+			continue
+		}
+		if err := visit(r.Scene); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Dispose cancels loading any regions.
+func (w *WorldStream) Dispose() {
+	for _, r := range w.Regions {
+		if r.state == regionLoading {
+			w.abandon(r)
+		}
+	}
+}
+
+// Update starts loading regions near the camera, and unloads regions far
+// from it.
+func (w *WorldStream) Update() error {
+	view := cameraView(w.camera, w.game.ScreenSize)
+	for _, r := range w.Regions {
+		d := rectGap(view, r.Bounds)
+		switch r.state {
+		case regionUnloaded:
+			if d <= w.LoadMargin {
+				w.startLoad(r)
+			}
+		case regionLoading:
+			if d > w.UnloadMargin {
+				w.abandon(r)
+			}
+		case regionLoaded:
+			if d > w.UnloadMargin {
+				w.unload(r)
+			}
+		case regionFailed:
+			if d > w.UnloadMargin {
+				r.state = regionUnloaded
+			}
+		}
+	}
+	return nil
+}
+
+func (w *WorldStream) startLoad(r *StreamRegion) {
+	ctx, cancel := context.WithCancel(context.Background())
+	r.state, r.cancel = regionLoading, cancel
+	w.game.loadInBackground(ctx, r.Scene, w, w.assets, nil, func(_ LoadStats, err error) {
+		w.finishLoad(r, err)
+	})
+}
+
+// abandon cancels loading the region. The load goroutine may still be using
+// r.Scene, so the region can't be loaded again until finishLoad is called.
+func (w *WorldStream) abandon(r *StreamRegion) {
+	r.cancel()
+	r.state = regionCancelling
+}
+
+// finishLoad is called (at the end of a game update) once the region's scene
+// is loaded, registered, and prepared, or has failed or been cancelled.
+func (w *WorldStream) finishLoad(r *StreamRegion, err error) {
+	r.cancel()
+	if r.state == regionCancelling || errors.Is(err, context.Canceled) {
+		// Drop anything the cancelled load left behind.
+		r.Scene.Scene = nil
+		r.state = regionUnloaded
+		return
+	}
+	if err != nil {
+		w.game.Log(LevelError, "WorldStream: couldn't load region", F("path", r.Scene.Path), F("err", err))
+		r.Scene.Scene = nil
+		r.state = regionFailed
+		return
+	}
+	r.state = regionLoaded
+	r.Scene.Enable()
+	r.Scene.Show()
+	w.game.Log(LevelDebug, "WorldStream: loaded region", F("path", r.Scene.Path))
+}
+
+// unload unregisters the region's scene and releases it.
+func (w *WorldStream) unload(r *StreamRegion) {
+	w.game.PathUnregister(r.Scene)
+	r.Scene.Scene = nil
+	r.state = regionUnloaded
+	w.game.Log(LevelDebug, "WorldStream: unloaded region", F("path", r.Scene.Path))
+}
+
+func (w *WorldStream) String() string { return "WorldStream" }
+
+// cameraView returns the bounding rectangle (in the same coordinates as
+// c.Centre) of the area visible through the camera.
+func cameraView(c *Camera, screen image.Point) image.Rectangle {
+	zoom := c.Zoom
+	if zoom <= 0 {
+		zoom = 1
+	}
+	hx, hy := float64(screen.X)/(2*zoom), float64(screen.Y)/(2*zoom)
+	if c.Rotation != 0 {
+		sin, cos := math.Abs(math.Sin(c.Rotation)), math.Abs(math.Cos(c.Rotation))
+		hx, hy = hx*cos+hy*sin, hx*sin+hy*cos
+	}
+	// Round up, but not because of floating-point error.
+	h := image.Pt(int(math.Ceil(hx-1e-6)), int(math.Ceil(hy-1e-6)))
+	return image.Rectangle{c.Centre.Sub(h), c.Centre.Add(h)}
+}
+
+// rectGap returns the distance between two rectangles along whichever axis
+// separates them the most, or 0 if they overlap or touch.
+func rectGap(a, b image.Rectangle) int {
+	d := 0
+	for _, g := range []int{
+		b.Min.X - a.Max.X,
+		a.Min.X - b.Max.X,
+		b.Min.Y - a.Max.Y,
+		a.Min.Y - b.Max.Y,
+	} {
+		if g > d {
+			d = g
+		}
+	}
+	return d
+}
@@ -0,0 +1,219 @@
+/*
+Copyright 2021 Josh Deprez
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import (
+	"image"
+	"io/fs"
+	"math"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestWorldStream(t *testing.T) {
+	assets := fstest.MapFS{
+		"a.gobz": {Data: gobz(t, &Scene{ID: "a", Child: MakeContainer()})},
+		"b.gobz": {Data: gobz(t, &Scene{ID: "b", Child: MakeContainer()})},
+		"c.gobz": {Data: gobz(t, &Scene{ID: "c", Child: MakeContainer()})},
+	}
+	a := &StreamRegion{Bounds: image.Rect(0, 0, 100, 100), Scene: &SceneRef{Path: "a.gobz"}}
+	b := &StreamRegion{Bounds: image.Rect(150, 0, 250, 100), Scene: &SceneRef{Path: "b.gobz"}}
+	c := &StreamRegion{Bounds: image.Rect(400, 0, 500, 100), Scene: &SceneRef{Path: "c.gobz"}}
+	missing := &StreamRegion{Bounds: image.Rect(0, -200, 100, -100), Scene: &SceneRef{Path: "missing.gobz"}}
+	ws := &WorldStream{
+		CameraID:     "cam",
+		Regions:      []*StreamRegion{a, b, c, missing},
+		LoadMargin:   50,
+		UnloadMargin: 150,
+	}
+	cam := &Camera{ID: "cam", Child: ws, Zoom: 1}
+	g := &Game{
+		ScreenSize: image.Pt(100, 100),
+		Root:       &DrawDFS{Child: cam},
+	}
+	if err := g.LoadAndPrepare(assets); err != nil {
+		t.Fatalf("LoadAndPrepare() = %v", err)
+	}
+
+	// update updates the game until no regions are loading.
+	update := func() {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			if err := g.Update(); err != nil {
+				t.Fatalf("g.Update() = %v", err)
+			}
+			loading := false
+			for _, r := range ws.Regions {
+				loading = loading || r.state == regionLoading || r.state == regionCancelling
+			}
+			if !loading {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("regions still loading after deadline")
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	check := func(when string, want map[*StreamRegion]bool) {
+		t.Helper()
+		for r, loaded := range want {
+			if got := r.Loaded(); got != loaded {
+				t.Errorf("%s: %v.Loaded() = %v, want %v", when, r.Scene, got, loaded)
+			}
+			if got := g.Parent(r.Scene) != nil; got != loaded {
+				t.Errorf("%s: %v registered = %v, want %v", when, r.Scene, got, loaded)
+			}
+			if got := r.Scene.Scene != nil; got != loaded {
+				t.Errorf("%s: %v scene present = %v, want %v", when, r.Scene, got, loaded)
+			}
+		}
+	}
+
+	update()
+	check("at 0", map[*StreamRegion]bool{a: true, b: false, c: false, missing: false})
+	if got, want := missing.state, regionFailed; got != want {
+		t.Errorf("missing.state = %v, want %v", got, want)
+	}
+	if got, want := g.Component("a"), Identifier(a.Scene); got != want {
+		t.Errorf("g.Component(a) = %v, want %v", got, want)
+	}
+
+	cam.Centre = image.Pt(100, 0)
+	update()
+	check("at 100", map[*StreamRegion]bool{a: true, b: true, c: false})
+
+	// a is 150 from the view: further than LoadMargin, but not UnloadMargin.
+	cam.Centre = image.Pt(300, 0)
+	update()
+	check("at 300", map[*StreamRegion]bool{a: true, b: true, c: true})
+
+	cam.Centre = image.Pt(310, 0)
+	update()
+	check("at 310", map[*StreamRegion]bool{a: false, b: true, c: true, missing: false})
+	if got, want := missing.state, regionUnloaded; got != want {
+		t.Errorf("missing.state = %v, want %v", got, want)
+	}
+
+	cam.Centre = image.Pt(0, 0)
+	update()
+	check("back at 0", map[*StreamRegion]bool{a: true, b: true, c: false})
+}
+
+// gatedFS is an fs.FS whose Open waits until gate is closed.
+type gatedFS struct {
+	fs.FS
+	gate chan struct{}
+}
+
+func (g gatedFS) Open(name string) (fs.File, error) {
+	<-g.gate
+	return g.FS.Open(name)
+}
+
+func TestWorldStreamCancelThenReload(t *testing.T) {
+	assets := gatedFS{
+		FS: fstest.MapFS{
+			"a.gobz": {Data: gobz(t, &Scene{ID: "a", Child: MakeContainer()})},
+		},
+		gate: make(chan struct{}),
+	}
+	a := &StreamRegion{Bounds: image.Rect(0, 0, 100, 100), Scene: &SceneRef{Path: "a.gobz"}}
+	ws := &WorldStream{
+		CameraID:     "cam",
+		Regions:      []*StreamRegion{a},
+		LoadMargin:   50,
+		UnloadMargin: 150,
+	}
+	cam := &Camera{ID: "cam", Child: ws, Zoom: 1, Centre: image.Pt(1000, 0)}
+	g := &Game{
+		ScreenSize: image.Pt(100, 100),
+		Root:       &DrawDFS{Child: cam},
+	}
+	if err := g.LoadAndPrepare(assets); err != nil {
+		t.Fatalf("LoadAndPrepare() = %v", err)
+	}
+	update := func() {
+		t.Helper()
+		if err := g.Update(); err != nil {
+			t.Fatalf("g.Update() = %v", err)
+		}
+	}
+
+	// Start loading, abandon it, and come back while the first load is
+	// still stuck opening the file.
+	cam.Centre = image.Pt(0, 0)
+	update()
+	cam.Centre = image.Pt(1000, 0)
+	update()
+	cam.Centre = image.Pt(0, 0)
+	update()
+	if got, want := a.state, regionCancelling; got != want {
+		t.Fatalf("a.state while cancelled load is running = %v, want %v", got, want)
+	}
+
+	close(assets.gate)
+	deadline := time.Now().Add(5 * time.Second)
+	for !a.Loaded() {
+		if time.Now().After(deadline) {
+			t.Fatalf("a not loaded after deadline; a.state = %v", a.state)
+		}
+		update()
+		time.Sleep(time.Millisecond)
+	}
+	if g.Parent(a.Scene) != ws || g.Component("a") == nil {
+		t.Errorf("a loaded but not registered: parent = %v", g.Parent(a.Scene))
+	}
+}
+
+func TestCameraView(t *testing.T) {
+	screen := image.Pt(320, 240)
+	tests := []struct {
+		cam  Camera
+		want image.Rectangle
+	}{
+		{Camera{Zoom: 1}, image.Rect(-160, -120, 160, 120)},
+		{Camera{Centre: image.Pt(10, 20), Zoom: 2}, image.Rect(-70, -40, 90, 80)},
+		{Camera{Zoom: 1, Rotation: math.Pi / 2}, image.Rect(-120, -160, 120, 160)},
+	}
+	for _, test := range tests {
+		if got := cameraView(&test.cam, screen); got != test.want {
+			t.Errorf("cameraView(%v) = %v, want %v", &test.cam, got, test.want)
+		}
+	}
+}
+
+func TestRectGap(t *testing.T) {
+	r := image.Rect(0, 0, 10, 10)
+	tests := []struct {
+		other image.Rectangle
+		want  int
+	}{
+		{image.Rect(5, 5, 15, 15), 0},
+		{image.Rect(10, 0, 20, 10), 0},
+		{image.Rect(13, 0, 20, 10), 3},
+		{image.Rect(-20, -20, -5, -2), 5},
+		{image.Rect(12, 30, 20, 40), 20},
+	}
+	for _, test := range tests {
+		if got := rectGap(r, test.other); got != test.want {
+			t.Errorf("rectGap(%v, %v) = %v, want %v", r, test.other, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,565 @@
+/*
+Copyright 2021 Josh Deprez
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/base64"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// The text format is JSON. Values stored in interfaces are written as objects
+// with the registered type name (see RegisterType) and the value:
+//
+//	{"$type": "*engine.Scene", "$value": {"ID": "level_1", ...}}
+//
+// Structs are written as objects keyed by field name, omitting unexported and
+// zero-valued fields (like gob). Maps with string keys are written as objects,
+// and other maps are written as arrays of [key, value] pairs, sorted by key.
+// Containers are written as arrays of their items, and types implementing
+// encoding.TextMarshaler are written as strings.
+const (
+	textTypeKey  = "$type"
+	textValueKey = "$value"
+
+	// textFormatVersion is the version of the text format, which is separate
+	// from the gob format version (see FormatVersion). It should be increased
+	// if the text format changes in a way older programs can't read.
+	textFormatVersion = 0
+)
+
+var (
+	typesMu    sync.RWMutex
+	typeByName = make(map[string]reflect.Type)
+	nameByType = make(map[reflect.Type]string)
+
+	containerPtrType    = reflect.TypeOf((*Container)(nil))
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// RegisterType registers the type of value with gob (see gob.Register), and
+// with the text format under the same name. Types stored in interface values
+// (such as components in a Container) must be registered to be saved and
+// loaded. Like gob.Register, it is intended to be called from init functions.
+func RegisterType(value any) {
+	gob.Register(value)
+	t := reflect.TypeOf(value)
+	name := gobTypeName(t)
+	typesMu.Lock()
+	defer typesMu.Unlock()
+	typeByName[name] = t
+	nameByType[t] = name
+}
+
+// gobTypeName returns the name that gob.Register uses for a type. (For
+// compatibility reasons, gob names pointer types using String, which uses
+// the package name rather than the full package path.)
+func gobTypeName(rt reflect.Type) string {
+	if rt.Name() == "" {
+		return rt.String()
+	}
+	if rt.PkgPath() == "" {
+		return rt.Name()
+	}
+	return rt.PkgPath() + "." + rt.Name()
+}
+
+// textFile is the top level of the text format.
+type textFile struct {
+	FormatVersion int    `json:"formatVersion"`
+	EngineVersion string `json:"engineVersion"`
+	Value         any    `json:"value"`
+}
+
+// LoadText decodes a component from a text (JSON) file in a FS. The type of
+// the value in the file must be the type of dst, or dst must point to an
+// interface that the value can be assigned to. Files saved with a newer text
+// format version cause a *FormatVersionError. The text format has its own
+// version: migrations registered with RegisterMigration only apply to gobz
+// files, since text files are decoded by field name, and added and removed
+// fields are tolerated (unknown fields are ignored).
+func LoadText(dst any, assets fs.FS, path string) error {
+	f, err := assets.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := DecodeText(f, dst); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// SaveText encodes a component as text (JSON), and writes it to a file in a
+// WriteFS. The file can be loaded with LoadText using the same path.
+func SaveText(src any, dst WriteFS, path string) error {
+	var buf bytes.Buffer
+	if err := EncodeText(&buf, src); err != nil {
+		return err
+	}
+	return dst.WriteFile(path, buf.Bytes())
+}
+
+// EncodeText writes src to w in the text format.
+func EncodeText(w io.Writer, src any) error {
+	v, err := encodeText(reflect.ValueOf(&src).Elem())
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(textFile{
+		FormatVersion: textFormatVersion,
+		EngineVersion: engineVersion(),
+		Value:         v,
+	})
+}
+
+// DecodeText reads a value in the text format from r into dst, which must be
+// a non-nil pointer.
+func DecodeText(r io.Reader, dst any) error {
+	dv := reflect.ValueOf(dst)
+	if dv.Kind() != reflect.Pointer || dv.IsNil() {
+		return fmt.Errorf("DecodeText: dst must be a non-nil pointer, got %T", dst)
+	}
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	var file textFile
+	if err := dec.Decode(&file); err != nil {
+		return err
+	}
+	if file.FormatVersion > textFormatVersion {
+		return &FormatVersionError{
+			Version:       file.FormatVersion,
+			Supported:     textFormatVersion,
+			EngineVersion: file.EngineVersion,
+		}
+	}
+	if dv.Elem().Kind() == reflect.Interface {
+		return decodeText(file.Value, dv.Elem())
+	}
+	t, inner, err := textTypedValue(file.Value)
+	if err != nil {
+		return err
+	}
+	if t != dv.Type() {
+		return fmt.Errorf("file contains %v, want %v", t, dv.Type())
+	}
+	return decodeText(inner, dv.Elem())
+}
+
+// encodeText converts v into a value that encoding/json can marshal.
+func encodeText(v reflect.Value) (any, error) {
+	t := v.Type()
+	switch t.Kind() {
+	case reflect.Interface:
+		if v.IsNil() {
+			return nil, nil
+		}
+		e := v.Elem()
+		typesMu.RLock()
+		name, ok := nameByType[e.Type()]
+		typesMu.RUnlock()
+		if !ok {
+			return nil, fmt.Errorf("type %v not registered (use RegisterType)", e.Type())
+		}
+		inner, err := encodeText(e)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{textTypeKey: name, textValueKey: inner}, nil
+
+	case reflect.Pointer:
+		if v.IsNil() {
+			return nil, nil
+		}
+		if t == containerPtrType {
+			// Encode a compacted copy, so as not to renumber the items of
+			// a container that may be in use.
+			c := v.Interface().(*Container)
+			items := make([]any, 0, c.ItemCount())
+			c.Scan(func(x any) error {
+				items = append(items, x)
+				return nil
+			})
+			return encodeText(reflect.ValueOf(items))
+		}
+		if t.Implements(textMarshalerType) {
+			return marshalText(v)
+		}
+		return encodeText(v.Elem())
+	}
+
+	// Check the same receivers as decodeText, which uses a pointer.
+	if reflect.PointerTo(t).Implements(textMarshalerType) {
+		if !v.CanAddr() {
+			p := reflect.New(t)
+			p.Elem().Set(v)
+			v = p.Elem()
+		}
+		return marshalText(v.Addr())
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		m := make(map[string]any)
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !textField(f) || v.Field(i).IsZero() {
+				continue
+			}
+			fv, err := encodeText(v.Field(i))
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", f.Name, err)
+			}
+			m[f.Name] = fv
+		}
+		return m, nil
+
+	case reflect.Map:
+		if v.IsNil() {
+			return nil, nil
+		}
+		if t.Key().Kind() == reflect.String {
+			m := make(map[string]any, v.Len())
+			iter := v.MapRange()
+			for iter.Next() {
+				ev, err := encodeText(iter.Value())
+				if err != nil {
+					return nil, fmt.Errorf("[%q]: %w", iter.Key().String(), err)
+				}
+				m[iter.Key().String()] = ev
+			}
+			return m, nil
+		}
+		type pair struct {
+			sortKey string
+			kv      []any
+		}
+		pairs := make([]pair, 0, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			k, err := encodeText(iter.Key())
+			if err != nil {
+				return nil, fmt.Errorf("map key: %w", err)
+			}
+			sk, err := json.Marshal(k)
+			if err != nil {
+				return nil, fmt.Errorf("map key: %w", err)
+			}
+			ev, err := encodeText(iter.Value())
+			if err != nil {
+				return nil, fmt.Errorf("[%s]: %w", sk, err)
+			}
+			pairs = append(pairs, pair{string(sk), []any{k, ev}})
+		}
+		sort.Slice(pairs, func(i, j int) bool { return pairs[i].sortKey < pairs[j].sortKey })
+		out := make([]any, len(pairs))
+		for i, p := range pairs {
+			out[i] = p.kv
+		}
+		return out, nil
+
+	case reflect.Slice:
+		if v.IsNil() {
+			return nil, nil
+		}
+		if t.Elem().Kind() == reflect.Uint8 {
+			return base64.StdEncoding.EncodeToString(v.Bytes()), nil
+		}
+		fallthrough
+	case reflect.Array:
+		out := make([]any, v.Len())
+		for i := range out {
+			ev, err := encodeText(v.Index(i))
+			if err != nil {
+				return nil, fmt.Errorf("[%d]: %w", i, err)
+			}
+			out[i] = ev
+		}
+		return out, nil
+
+	case reflect.Bool:
+		return v.Bool(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint(), nil
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), nil
+	case reflect.String:
+		return v.String(), nil
+	}
+	return nil, fmt.Errorf("unsupported type %v", t)
+}
+
+func marshalText(v reflect.Value) (any, error) {
+	b, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// textField reports whether a struct field is included in the text format.
+// Like gob, unexported fields and chan and func fields are ignored.
+func textField(f reflect.StructField) bool {
+	if !f.IsExported() {
+		return false
+	}
+	switch f.Type.Kind() {
+	case reflect.Chan, reflect.Func:
+		return false
+	}
+	return true
+}
+
+// textTypedValue splits a {"$type": ..., "$value": ...} object.
+func textTypedValue(in any) (reflect.Type, any, error) {
+	m, ok := in.(map[string]any)
+	if !ok {
+		return nil, nil, fmt.Errorf("want object with %q, got %T", textTypeKey, in)
+	}
+	name, ok := m[textTypeKey].(string)
+	if !ok {
+		return nil, nil, fmt.Errorf("missing %q", textTypeKey)
+	}
+	typesMu.RLock()
+	t, ok := typeByName[name]
+	typesMu.RUnlock()
+	if !ok {
+		return nil, nil, fmt.Errorf("type %q not registered (use RegisterType)", name)
+	}
+	return t, m[textValueKey], nil
+}
+
+// decodeText stores the JSON value in (as decoded with UseNumber) into v,
+// which must be settable.
+func decodeText(in any, v reflect.Value) error {
+	t := v.Type()
+	if in == nil {
+		v.Set(reflect.Zero(t))
+		return nil
+	}
+
+	switch t.Kind() {
+	case reflect.Interface:
+		et, inner, err := textTypedValue(in)
+		if err != nil {
+			return err
+		}
+		if !et.AssignableTo(t) {
+			return fmt.Errorf("type %v is not assignable to %v", et, t)
+		}
+		ev := reflect.New(et).Elem()
+		if err := decodeText(inner, ev); err != nil {
+			return err
+		}
+		v.Set(ev)
+		return nil
+
+	case reflect.Pointer:
+		if t == containerPtrType {
+			var items []any
+			if err := decodeText(in, reflect.ValueOf(&items).Elem()); err != nil {
+				return err
+			}
+			v.Set(reflect.ValueOf(MakeContainer(items...)))
+			return nil
+		}
+		if v.IsNil() {
+			v.Set(reflect.New(t.Elem()))
+		}
+		return decodeText(in, v.Elem())
+	}
+
+	if reflect.PointerTo(t).Implements(textUnmarshalerType) {
+		s, ok := in.(string)
+		if !ok {
+			return fmt.Errorf("want string for %v, got %T", t, in)
+		}
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		m, ok := in.(map[string]any)
+		if !ok {
+			return fmt.Errorf("want object for %v, got %T", t, in)
+		}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			fin, ok := m[f.Name]
+			if !ok || !textField(f) {
+				continue
+			}
+			if err := decodeText(fin, v.Field(i)); err != nil {
+				return fmt.Errorf("%s: %w", f.Name, err)
+			}
+		}
+		return nil
+
+	case reflect.Map:
+		mv := reflect.MakeMap(t)
+		if t.Key().Kind() == reflect.String {
+			m, ok := in.(map[string]any)
+			if !ok {
+				return fmt.Errorf("want object for %v, got %T", t, in)
+			}
+			for k, ein := range m {
+				kv := reflect.New(t.Key()).Elem()
+				kv.SetString(k)
+				ev := reflect.New(t.Elem()).Elem()
+				if err := decodeText(ein, ev); err != nil {
+					return fmt.Errorf("[%q]: %w", k, err)
+				}
+				mv.SetMapIndex(kv, ev)
+			}
+			v.Set(mv)
+			return nil
+		}
+		pairs, ok := in.([]any)
+		if !ok {
+			return fmt.Errorf("want array of pairs for %v, got %T", t, in)
+		}
+		for i, p := range pairs {
+			kv, ok := p.([]any)
+			if !ok || len(kv) != 2 {
+				return fmt.Errorf("[%d]: want [key, value] pair, got %v", i, p)
+			}
+			k := reflect.New(t.Key()).Elem()
+			if err := decodeText(kv[0], k); err != nil {
+				return fmt.Errorf("[%d] key: %w", i, err)
+			}
+			ev := reflect.New(t.Elem()).Elem()
+			if err := decodeText(kv[1], ev); err != nil {
+				return fmt.Errorf("[%d] value: %w", i, err)
+			}
+			mv.SetMapIndex(k, ev)
+		}
+		v.Set(mv)
+		return nil
+
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			s, ok := in.(string)
+			if !ok {
+				return fmt.Errorf("want base64 string for %v, got %T", t, in)
+			}
+			b, err := base64.StdEncoding.DecodeString(s)
+			if err != nil {
+				return err
+			}
+			v.SetBytes(b)
+			return nil
+		}
+		arr, ok := in.([]any)
+		if !ok {
+			return fmt.Errorf("want array for %v, got %T", t, in)
+		}
+		v.Set(reflect.MakeSlice(t, len(arr), len(arr)))
+		return decodeTextElems(arr, v)
+
+	case reflect.Array:
+		arr, ok := in.([]any)
+		if !ok {
+			return fmt.Errorf("want array for %v, got %T", t, in)
+		}
+		if len(arr) > v.Len() {
+			return fmt.Errorf("too many elements for %v: %d", t, len(arr))
+		}
+		return decodeTextElems(arr, v)
+
+	case reflect.Bool:
+		b, ok := in.(bool)
+		if !ok {
+			return fmt.Errorf("want bool for %v, got %T", t, in)
+		}
+		v.SetBool(b)
+		return nil
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, ok := in.(json.Number)
+		if !ok {
+			return fmt.Errorf("want number for %v, got %T", t, in)
+		}
+		i, err := strconv.ParseInt(n.String(), 10, 64)
+		if err != nil {
+			return err
+		}
+		if v.OverflowInt(i) {
+			return fmt.Errorf("%d overflows %v", i, t)
+		}
+		v.SetInt(i)
+		return nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, ok := in.(json.Number)
+		if !ok {
+			return fmt.Errorf("want number for %v, got %T", t, in)
+		}
+		u, err := strconv.ParseUint(n.String(), 10, 64)
+		if err != nil {
+			return err
+		}
+		if v.OverflowUint(u) {
+			return fmt.Errorf("%d overflows %v", u, t)
+		}
+		v.SetUint(u)
+		return nil
+
+	case reflect.Float32, reflect.Float64:
+		n, ok := in.(json.Number)
+		if !ok {
+			return fmt.Errorf("want number for %v, got %T", t, in)
+		}
+		f, err := n.Float64()
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+		return nil
+
+	case reflect.String:
+		s, ok := in.(string)
+		if !ok {
+			return fmt.Errorf("want string for %v, got %T", t, in)
+		}
+		v.SetString(s)
+		return nil
+	}
+	return fmt.Errorf("unsupported type %v", t)
+}
+
+func decodeTextElems(arr []any, v reflect.Value) error {
+	for i, ein := range arr {
+		if err := decodeText(ein, v.Index(i)); err != nil {
+			return fmt.Errorf("[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
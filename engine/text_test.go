@@ -0,0 +1,201 @@
+/*
+Copyright 2021 Josh Deprez
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"io/fs"
+	"strings"
+	"testing"
+
+	"github.com/DrJosh9000/ichigo/geom"
+)
+
+func TestTextRoundTrip(t *testing.T) {
+	src := &Scene{
+		ID:     "level",
+		Bounds: Bounds(image.Rect(0, 0, 320, 240)),
+		Child: MakeContainer(
+			&Fill{ID: "bg", Colour: color.RGBA{R: 1, G: 2, B: 3, A: 255}},
+			&Tilemap{
+				ID: "tiles",
+				Map: map[image.Point]Tile{
+					{X: 0, Y: 0}: StaticTile(3),
+					{X: 1, Y: 0}: &AnimatedTile{AnimKey: "water"},
+				},
+				Sheet: Sheet{CellSize: image.Pt(16, 16), Src: ImageRef{Path: "tiles.png"}},
+			},
+			&PrismMap{
+				ID: "prisms",
+				Map: map[geom.Int3]*Prism{
+					geom.Pt3(1, 2, 3):  {},
+					geom.Pt3(-1, 0, 0): {},
+				},
+			},
+			&SceneRef{Path: "other.gobz"},
+		),
+	}
+
+	var enc bytes.Buffer
+	if err := EncodeText(&enc, src); err != nil {
+		t.Fatalf("EncodeText() = %v, want nil", err)
+	}
+	got := new(Scene)
+	if err := DecodeText(bytes.NewReader(enc.Bytes()), got); err != nil {
+		t.Fatalf("DecodeText() = %v, want nil", err)
+	}
+
+	var reenc bytes.Buffer
+	if err := EncodeText(&reenc, got); err != nil {
+		t.Fatalf("EncodeText(decoded) = %v, want nil", err)
+	}
+	if enc.String() != reenc.String() {
+		t.Errorf("re-encoded text differs:\n%s\nwant:\n%s", reenc.String(), enc.String())
+	}
+
+	items := got.Child.(*Container).items
+	if len(items) != 4 {
+		t.Fatalf("decoded container has %d items, want 4", len(items))
+	}
+	if c := items[0].(*Fill).Colour; c != (color.RGBA{R: 1, G: 2, B: 3, A: 255}) {
+		t.Errorf("Fill.Colour = %v, want RGBA{1, 2, 3, 255}", c)
+	}
+	tm := items[1].(*Tilemap)
+	if tile := tm.Map[image.Pt(0, 0)]; tile != StaticTile(3) {
+		t.Errorf("Tilemap.Map[0,0] = %v, want StaticTile(3)", tile)
+	}
+	if at, ok := tm.Map[image.Pt(1, 0)].(*AnimatedTile); !ok || at.AnimKey != "water" {
+		t.Errorf("Tilemap.Map[1,0] = %v, want AnimatedTile{water}", tm.Map[image.Pt(1, 0)])
+	}
+	if _, ok := items[2].(*PrismMap).Map[geom.Pt3(-1, 0, 0)]; !ok {
+		t.Error("PrismMap.Map missing key (-1, 0, 0)")
+	}
+	if p := items[3].(*SceneRef).Path; p != "other.gobz" {
+		t.Errorf("SceneRef.Path = %q, want other.gobz", p)
+	}
+}
+
+// textName has MarshalText and UnmarshalText methods with pointer receivers,
+// and no exported fields.
+type textName struct{ first, last string }
+
+func (n *textName) MarshalText() ([]byte, error) {
+	return []byte(n.first + " " + n.last), nil
+}
+
+func (n *textName) UnmarshalText(b []byte) error {
+	n.first, n.last, _ = strings.Cut(string(b), " ")
+	return nil
+}
+
+type textNameHolder struct {
+	Name  textName
+	Alias any
+}
+
+func init() {
+	RegisterType(&textNameHolder{})
+	RegisterType(textName{})
+}
+
+func TestTextPointerReceiverMarshaler(t *testing.T) {
+	src := &textNameHolder{
+		Name:  textName{"Ichigo", "Kurosaki"},
+		Alias: textName{"Strawberry", "Boy"}, // not addressable
+	}
+	var enc bytes.Buffer
+	if err := EncodeText(&enc, src); err != nil {
+		t.Fatalf("EncodeText() = %v, want nil", err)
+	}
+	for _, want := range []string{`"Ichigo Kurosaki"`, `"Strawberry Boy"`} {
+		if !strings.Contains(enc.String(), want) {
+			t.Errorf("EncodeText() wrote %s, want it to contain %s", enc.String(), want)
+		}
+	}
+	got := new(textNameHolder)
+	if err := DecodeText(bytes.NewReader(enc.Bytes()), got); err != nil {
+		t.Fatalf("DecodeText() = %v, want nil", err)
+	}
+	if *got != *src {
+		t.Errorf("decoded = %+v, want %+v", *got, *src)
+	}
+}
+
+func TestTextEncodeLeavesContainer(t *testing.T) {
+	a, b := &Scene{ID: "a"}, &Scene{ID: "b"}
+	c := MakeContainer(a, b)
+	c.Remove(a)
+	if err := EncodeText(new(bytes.Buffer), &Scene{Child: c}); err != nil {
+		t.Fatalf("EncodeText() = %v, want nil", err)
+	}
+	if i, ok := c.IndexOf(b); !ok || i != 1 {
+		t.Errorf("c.IndexOf(b) after EncodeText = %d, %t, want 1, true", i, ok)
+	}
+}
+
+func TestTextFormatVersion(t *testing.T) {
+	// Gob migrations don't affect the text format.
+	noop := func(p []byte) ([]byte, error) { return p, nil }
+	withMigrations(t, noop, noop)
+	var enc bytes.Buffer
+	if err := EncodeText(&enc, &Scene{ID: "a"}); err != nil {
+		t.Fatalf("EncodeText() = %v, want nil", err)
+	}
+	if err := DecodeText(bytes.NewReader(enc.Bytes()), new(Scene)); err != nil {
+		t.Errorf("DecodeText() = %v, want nil", err)
+	}
+
+	newer := strings.Replace(enc.String(), `"formatVersion": 0`, `"formatVersion": 1`, 1)
+	var fve *FormatVersionError
+	if err := DecodeText(strings.NewReader(newer), new(Scene)); !errors.As(err, &fve) {
+		t.Errorf("DecodeText(newer) = %v, want *FormatVersionError", err)
+	}
+}
+
+func TestTextUnregisteredType(t *testing.T) {
+	type unregistered struct{ X int }
+	err := EncodeText(new(bytes.Buffer), &Scene{Child: MakeContainer(&unregistered{})})
+	if err == nil || !strings.Contains(err.Error(), "not registered") {
+		t.Errorf("EncodeText(unregistered) = %v, want not registered error", err)
+	}
+}
+
+func TestSceneRefTextCodec(t *testing.T) {
+	var mfs MemFS
+	ref := &SceneRef{Path: "level" + TextExt, Scene: &Scene{ID: "saved", Child: MakeContainer()}}
+	if err := ref.Save(&mfs); err != nil {
+		t.Fatalf("Save() = %v, want nil", err)
+	}
+	data, err := fs.ReadFile(&mfs, ref.Path)
+	if err != nil {
+		t.Fatalf("ReadFile(%q) = %v", ref.Path, err)
+	}
+	if !bytes.Contains(data, []byte(textTypeKey)) {
+		t.Errorf("saved file is not in the text format:\n%s", data)
+	}
+
+	loaded := &SceneRef{Path: ref.Path}
+	if err := loaded.Load(&mfs); err != nil {
+		t.Fatalf("Load() = %v, want nil", err)
+	}
+	if got, want := loaded.Ident(), "saved"; got != want {
+		t.Errorf("loaded.Ident() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,836 @@
+/*
+Copyright 2021 Josh Deprez
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"io/fs"
+	"math"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DrJosh9000/ichigo/geom"
+)
+
+// Ensure TiledRef satisfies interfaces.
+var _ interface {
+	Loader
+	Reloader
+	scener
+	encoding.TextMarshaler
+	encoding.TextUnmarshaler
+} = &TiledRef{}
+
+func init() {
+	RegisterType(&TiledRef{})
+}
+
+// TiledRef loads a map made with Tiled (https://www.mapeditor.org) from the
+// asset FS, using ImportTiled. After Load, Scene is usable. Like SceneRef, only
+// the path is encoded.
+type TiledRef struct {
+	Path string
+
+	*Scene // not encoded
+}
+
+// GobDecode saves the byte slice as Path.
+func (r *TiledRef) GobDecode(b []byte) error {
+	r.Path = string(b)
+	return nil
+}
+
+// GobEncode returns Path as a byte slice.
+func (r *TiledRef) GobEncode() ([]byte, error) {
+	return []byte(r.Path), nil
+}
+
+// MarshalText returns Path as a byte slice.
+func (r *TiledRef) MarshalText() ([]byte, error) { return r.GobEncode() }
+
+// UnmarshalText saves the byte slice as Path.
+func (r *TiledRef) UnmarshalText(b []byte) error { return r.GobDecode(b) }
+
+// Load imports the map from the file.
+func (r *TiledRef) Load(assets fs.FS) error {
+	sc, err := ImportTiled(assets, r.Path)
+	if err != nil {
+		return err
+	}
+	r.Scene = sc
+	return nil
+}
+
+// AssetPath returns r.Path.
+func (r *TiledRef) AssetPath() string { return r.Path }
+
+// Reload imports the map again, and replaces the current scene in place (see
+// SceneRef.Reload). Note that changes to external tilesets are only noticed
+// when the map file itself changes.
+func (r *TiledRef) Reload(game *Game, assets fs.FS) error {
+	sc, err := ImportTiled(assets, r.Path)
+	if err != nil {
+		return err
+	}
+	if err := game.Load(sc, assets); err != nil {
+		return err
+	}
+	return replaceScene(game, r, &r.Scene, sc)
+}
+
+// Scan visits r.Scene.Child, if the map has been loaded.
+func (r *TiledRef) Scan(visit VisitFunc) error {
+	if r.Scene == nil {
+		return nil
+	}
+	return r.Scene.Scan(visit)
+}
+
+func (r *TiledRef) String() string { return "TiledRef{" + r.Path + "}" }
+
+// ImportTiled reads a Tiled map, in either the JSON (.tmj, .json) or XML
+// (.tmx) format, and converts it into a Scene. Each layer becomes a component
+// in the scene, in order:
+//
+//   - Tile layers become Tilemaps, or Walls if the layer has a custom bool
+//     property "wall" set to true. Tiles with animations become AnimatedTiles
+//     (with an AnimDef in the Sheet), and other tiles become StaticTiles.
+//     Each tile layer must only use tiles from one tileset. For Tilemaps, the
+//     tileset's tile size must match the map's tile size.
+//   - Object layers become Scenes containing a SolidRect for each rectangle
+//     object. Other kinds of object are ignored. The Z extent of each
+//     SolidRect is unbounded, unless set with custom int properties "minz" and
+//     "maxz".
+//   - Group layers are flattened (the offsets of the group apply to the
+//     layers within).
+//   - Image layers are ignored.
+//
+// Layer names become IDs (and object names become SolidRect IDs), so they
+// should be unique; duplicate object names within a layer are an error. The
+// map's custom string property "id", if set, becomes the ID of the scene.
+// Tilesets can be embedded or external (.tsx, .tsj), and must use a single
+// image with no margin or spacing. Paths to tilesets and images are relative
+// to the file referring to them. Tile layer data can be CSV or base64
+// (uncompressed, zlib, or gzip). Infinite maps, and flipped or rotated tiles,
+// are not supported, and cause an error.
+func ImportTiled(assets fs.FS, mapPath string) (*Scene, error) {
+	data, err := fs.ReadFile(assets, mapPath)
+	if err != nil {
+		return nil, err
+	}
+	var m *tiledMap
+	if isTiledXML(mapPath) {
+		m, err = parseTMX(data)
+	} else {
+		m, err = parseTMJ(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", mapPath, err)
+	}
+	if m.infinite {
+		return nil, fmt.Errorf("%s: infinite maps are not supported", mapPath)
+	}
+	for _, ts := range m.tilesets {
+		if err := ts.resolve(assets, path.Dir(mapPath)); err != nil {
+			return nil, fmt.Errorf("%s: %w", mapPath, err)
+		}
+	}
+	sort.Slice(m.tilesets, func(i, j int) bool {
+		return m.tilesets[i].firstGID < m.tilesets[j].firstGID
+	})
+	sc, err := m.scene()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", mapPath, err)
+	}
+	return sc, nil
+}
+
+// isTiledXML reports whether a Tiled file is in the XML format, based on the
+// extension.
+func isTiledXML(p string) bool {
+	switch strings.ToLower(path.Ext(p)) {
+	case ".tmx", ".tsx", ".xml":
+		return true
+	}
+	return false
+}
+
+// Tiled GIDs use the high bits for flipping and rotation flags.
+const tiledGIDMask = 0x0fffffff
+
+// tiledMap is the parts of a Tiled map that are used, whichever the format.
+type tiledMap struct {
+	width, height, tileWidth, tileHeight int
+	infinite                             bool
+	props                                map[string]string
+	layers                               []*tiledLayer
+	tilesets                             []*tiledTileset
+}
+
+type tiledLayer struct {
+	kind             string // "tilelayer", "objectgroup", "group", ...
+	name             string
+	visible          bool
+	offsetX, offsetY float64
+	width            int
+	data             []uint32
+	objects          []tiledObject
+	layers           []*tiledLayer
+	props            map[string]string
+}
+
+type tiledObject struct {
+	name                string
+	x, y, width, height float64
+	rect                bool // false for points, ellipses, polygons, tiles, ...
+	props               map[string]string
+}
+
+type tiledTileset struct {
+	firstGID   int
+	source     string // external tileset file, if any
+	image      string
+	tileWidth  int
+	tileHeight int
+	margin     int
+	spacing    int
+	anims      map[int][]tiledFrame
+}
+
+type tiledFrame struct {
+	tileID   int
+	duration int // milliseconds
+}
+
+// resolve loads an external tileset (if needed), and resolves the image path
+// relative to dir.
+func (ts *tiledTileset) resolve(assets fs.FS, dir string) error {
+	if ts.source != "" {
+		src := path.Join(dir, ts.source)
+		data, err := fs.ReadFile(assets, src)
+		if err != nil {
+			return err
+		}
+		var ext *tiledTileset
+		if isTiledXML(src) {
+			var raw tmxTileset
+			if err := xml.Unmarshal(data, &raw); err != nil {
+				return fmt.Errorf("%s: %w", src, err)
+			}
+			ext = raw.convert()
+		} else {
+			var raw tmjTileset
+			if err := json.Unmarshal(data, &raw); err != nil {
+				return fmt.Errorf("%s: %w", src, err)
+			}
+			ext = raw.convert()
+		}
+		ext.firstGID = ts.firstGID
+		*ts = *ext
+		dir = path.Dir(src)
+	}
+	if ts.image == "" {
+		return errors.New("image collection tilesets are not supported")
+	}
+	if ts.margin != 0 || ts.spacing != 0 {
+		return fmt.Errorf("tileset %q has margin or spacing, which is not supported", ts.image)
+	}
+	ts.image = path.Join(dir, ts.image)
+	return nil
+}
+
+// sheet returns a Sheet for the tileset.
+func (ts *tiledTileset) sheet() Sheet {
+	s := Sheet{
+		CellSize: image.Pt(ts.tileWidth, ts.tileHeight),
+		Src:      ImageRef{Path: ts.image},
+	}
+	if len(ts.anims) == 0 {
+		return s
+	}
+	s.AnimDefs = make(map[string]*AnimDef, len(ts.anims))
+	for id, frames := range ts.anims {
+		def := &AnimDef{Steps: make([]AnimStep, len(frames))}
+		for i, f := range frames {
+			def.Steps[i] = AnimStep{
+				Cell: f.tileID,
+				Time: time.Duration(f.duration) * time.Millisecond,
+			}
+		}
+		s.AnimDefs[tiledAnimKey(id)] = def
+	}
+	return s
+}
+
+// tiledAnimKey is the AnimDefs key for the animation of a tile.
+func tiledAnimKey(id int) string { return "tile" + strconv.Itoa(id) }
+
+// tilesetFor returns the tileset containing gid (tilesets must be sorted).
+func (m *tiledMap) tilesetFor(gid int) *tiledTileset {
+	var found *tiledTileset
+	for _, ts := range m.tilesets {
+		if ts.firstGID > gid {
+			break
+		}
+		found = ts
+	}
+	return found
+}
+
+// scene converts the map into a Scene.
+func (m *tiledMap) scene() (*Scene, error) {
+	var items []any
+	if err := m.convertLayers(&items, m.layers, 0, 0, true); err != nil {
+		return nil, err
+	}
+	return &Scene{
+		ID:     ID(m.props["id"]),
+		Bounds: Bounds(image.Rect(0, 0, m.width*m.tileWidth, m.height*m.tileHeight)),
+		Child:  MakeContainer(items...),
+	}, nil
+}
+
+func (m *tiledMap) convertLayers(items *[]any, layers []*tiledLayer, dx, dy float64, visible bool) error {
+	for _, l := range layers {
+		ox, oy := dx+l.offsetX, dy+l.offsetY
+		vis := visible && l.visible
+		var item any
+		var err error
+		switch l.kind {
+		case "tilelayer":
+			item, err = m.tileLayer(l, ox, oy, vis)
+		case "objectgroup":
+			item, err = m.objectLayer(l, ox, oy)
+		case "group":
+			err = m.convertLayers(items, l.layers, ox, oy, vis)
+		}
+		if err != nil {
+			return fmt.Errorf("layer %q: %w", l.name, err)
+		}
+		if item != nil {
+			*items = append(*items, item)
+		}
+	}
+	return nil
+}
+
+// tileLayer converts a tile layer into a Tilemap or Wall (or nil if empty).
+func (m *tiledMap) tileLayer(l *tiledLayer, ox, oy float64, visible bool) (any, error) {
+	var ts *tiledTileset
+	tiles := make(map[image.Point]Tile)
+	for i, raw := range l.data {
+		gid := int(raw & tiledGIDMask)
+		if gid == 0 {
+			continue
+		}
+		if raw&^tiledGIDMask != 0 {
+			return nil, fmt.Errorf("tile at %v is flipped or rotated, which is not supported", image.Pt(i%l.width, i/l.width))
+		}
+		t := m.tilesetFor(gid)
+		if t == nil {
+			return nil, fmt.Errorf("no tileset for tile %d", gid)
+		}
+		if ts == nil {
+			ts = t
+		} else if t != ts {
+			return nil, errors.New("layer uses more than one tileset")
+		}
+		id := gid - t.firstGID
+		var tile Tile = StaticTile(id)
+		if _, anim := t.anims[id]; anim {
+			tile = &AnimatedTile{AnimKey: tiledAnimKey(id)}
+		}
+		tiles[image.Pt(i%l.width, i/l.width)] = tile
+	}
+	if ts == nil {
+		return nil, nil
+	}
+	offset := image.Pt(int(math.Round(ox)), int(math.Round(oy)))
+
+	if l.props["wall"] == "true" {
+		units := make(map[image.Point]*WallUnit, len(tiles))
+		for p, tile := range tiles {
+			units[p] = &WallUnit{Tile: tile, Hides: Hides(!visible)}
+		}
+		return &Wall{
+			ID:     ID(l.name),
+			Offset: offset,
+			Sheet:  ts.sheet(),
+			// Tiled aligns tiles larger than the grid to the bottom-left.
+			UnitOffset: image.Pt(0, m.tileHeight-ts.tileHeight),
+			UnitSize:   image.Pt(m.tileWidth, m.tileHeight),
+			Units:      units,
+		}, nil
+	}
+
+	if ts.tileWidth != m.tileWidth || ts.tileHeight != m.tileHeight {
+		return nil, fmt.Errorf("tileset tile size %dx%d does not match map tile size %dx%d (use a wall layer instead)", ts.tileWidth, ts.tileHeight, m.tileWidth, m.tileHeight)
+	}
+	return &Tilemap{
+		ID:     ID(l.name),
+		Hides:  Hides(!visible),
+		Map:    tiles,
+		Offset: offset,
+		Sheet:  ts.sheet(),
+	}, nil
+}
+
+// objectLayer converts an object layer into a Scene of SolidRects.
+func (m *tiledMap) objectLayer(l *tiledLayer, ox, oy float64) (any, error) {
+	var solids []any
+	names := make(map[string]bool)
+	for _, o := range l.objects {
+		if !o.rect {
+			continue
+		}
+		if o.name != "" {
+			if names[o.name] {
+				return nil, fmt.Errorf("duplicate object name %q", o.name)
+			}
+			names[o.name] = true
+		}
+		minZ, maxZ := math.MinInt32, math.MaxInt32
+		if z, err := strconv.Atoi(o.props["minz"]); err == nil {
+			minZ = z
+		}
+		if z, err := strconv.Atoi(o.props["maxz"]); err == nil {
+			maxZ = z
+		}
+		x, y := int(math.Round(ox+o.x)), int(math.Round(oy+o.y))
+		w, h := int(math.Round(o.width)), int(math.Round(o.height))
+		solids = append(solids, &SolidRect{
+			ID: ID(o.name),
+			Box: geom.Box{
+				Min: geom.Pt3(x, y, minZ),
+				Max: geom.Pt3(x+w, y+h, maxZ),
+			},
+		})
+	}
+	return &Scene{
+		ID:    ID(l.name),
+		Child: MakeContainer(solids...),
+	}, nil
+}
+
+// decodeTiledData decodes CSV or base64 tile layer data.
+func decodeTiledData(encoding, compression, text string) ([]uint32, error) {
+	switch encoding {
+	case "csv":
+		var out []uint32
+		for _, f := range strings.Split(text, ",") {
+			f = strings.TrimSpace(f)
+			if f == "" {
+				continue
+			}
+			n, err := strconv.ParseUint(f, 10, 32)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, uint32(n))
+		}
+		return out, nil
+
+	case "base64":
+		b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(text))
+		if err != nil {
+			return nil, err
+		}
+		var r io.Reader = bytes.NewReader(b)
+		switch compression {
+		case "":
+		case "zlib":
+			if r, err = zlib.NewReader(r); err != nil {
+				return nil, err
+			}
+		case "gzip":
+			if r, err = gzip.NewReader(r); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("unsupported compression %q", compression)
+		}
+		b, err = io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		if len(b)%4 != 0 {
+			return nil, fmt.Errorf("tile data length %d is not a multiple of 4", len(b))
+		}
+		out := make([]uint32, len(b)/4)
+		for i := range out {
+			out[i] = binary.LittleEndian.Uint32(b[4*i:])
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("unsupported encoding %q", encoding)
+}
+
+// JSON format (.tmj, .tsj).
+
+type tmjMap struct {
+	Width, Height         int
+	TileWidth, TileHeight int
+	Infinite              bool
+	Properties            []tmjProperty
+	Layers                []*tmjLayer
+	Tilesets              []*tmjTileset
+}
+
+type tmjProperty struct {
+	Name  string
+	Value any
+}
+
+type tmjLayer struct {
+	Type                  string
+	Name                  string
+	Visible               *bool
+	OffsetX, OffsetY      float64
+	Width                 int
+	Data                  json.RawMessage
+	Encoding, Compression string
+	Objects               []tmjObject
+	Layers                []*tmjLayer
+	Properties            []tmjProperty
+}
+
+type tmjObject struct {
+	Name                string
+	X, Y, Width, Height float64
+	GID                 uint32
+	Point, Ellipse      bool
+	Polygon, Polyline   []any
+	Text                any
+	Properties          []tmjProperty
+}
+
+type tmjTileset struct {
+	FirstGID              int
+	Source                string
+	Image                 string
+	TileWidth, TileHeight int
+	Margin, Spacing       int
+	Tiles                 []struct {
+		ID        int
+		Animation []struct {
+			TileID   int
+			Duration int
+		}
+	}
+}
+
+func parseTMJ(data []byte) (*tiledMap, error) {
+	var raw tmjMap
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	m := &tiledMap{
+		width:      raw.Width,
+		height:     raw.Height,
+		tileWidth:  raw.TileWidth,
+		tileHeight: raw.TileHeight,
+		infinite:   raw.Infinite,
+		props:      tmjProps(raw.Properties),
+	}
+	for _, ts := range raw.Tilesets {
+		m.tilesets = append(m.tilesets, ts.convert())
+	}
+	var err error
+	m.layers, err = tmjLayers(raw.Layers)
+	return m, err
+}
+
+func tmjProps(ps []tmjProperty) map[string]string {
+	m := make(map[string]string, len(ps))
+	for _, p := range ps {
+		m[p.Name] = fmt.Sprint(p.Value)
+	}
+	return m
+}
+
+func tmjLayers(raws []*tmjLayer) ([]*tiledLayer, error) {
+	var out []*tiledLayer
+	for _, r := range raws {
+		l := &tiledLayer{
+			kind:    r.Type,
+			name:    r.Name,
+			visible: r.Visible == nil || *r.Visible,
+			offsetX: r.OffsetX,
+			offsetY: r.OffsetY,
+			width:   r.Width,
+			props:   tmjProps(r.Properties),
+		}
+		if r.Type == "tilelayer" {
+			var err error
+			if l.data, err = r.tiles(); err != nil {
+				return nil, fmt.Errorf("layer %q: %w", r.Name, err)
+			}
+		}
+		for _, o := range r.Objects {
+			l.objects = append(l.objects, tiledObject{
+				name:   o.Name,
+				x:      o.X,
+				y:      o.Y,
+				width:  o.Width,
+				height: o.Height,
+				rect:   o.GID == 0 && !o.Point && !o.Ellipse && o.Polygon == nil && o.Polyline == nil && o.Text == nil,
+				props:  tmjProps(o.Properties),
+			})
+		}
+		var err error
+		if l.layers, err = tmjLayers(r.Layers); err != nil {
+			return nil, err
+		}
+		out = append(out, l)
+	}
+	return out, nil
+}
+
+// tiles decodes the layer data, which is either an array of GIDs or a string.
+func (r *tmjLayer) tiles() ([]uint32, error) {
+	d := bytes.TrimSpace(r.Data)
+	if len(d) == 0 {
+		return nil, nil
+	}
+	if d[0] == '[' {
+		var out []uint32
+		err := json.Unmarshal(d, &out)
+		return out, err
+	}
+	var s string
+	if err := json.Unmarshal(d, &s); err != nil {
+		return nil, err
+	}
+	enc := r.Encoding
+	if enc == "" {
+		enc = "csv"
+	}
+	return decodeTiledData(enc, r.Compression, s)
+}
+
+func (r *tmjTileset) convert() *tiledTileset {
+	ts := &tiledTileset{
+		firstGID:   r.FirstGID,
+		source:     r.Source,
+		image:      r.Image,
+		tileWidth:  r.TileWidth,
+		tileHeight: r.TileHeight,
+		margin:     r.Margin,
+		spacing:    r.Spacing,
+		anims:      make(map[int][]tiledFrame),
+	}
+	for _, t := range r.Tiles {
+		for _, f := range t.Animation {
+			ts.anims[t.ID] = append(ts.anims[t.ID], tiledFrame{tileID: f.TileID, duration: f.Duration})
+		}
+	}
+	return ts
+}
+
+// XML format (.tmx, .tsx).
+
+type tmxMap struct {
+	Width      int           `xml:"width,attr"`
+	Height     int           `xml:"height,attr"`
+	TileWidth  int           `xml:"tilewidth,attr"`
+	TileHeight int           `xml:"tileheight,attr"`
+	Infinite   int           `xml:"infinite,attr"`
+	Properties tmxProperties `xml:"properties"`
+	Tilesets   []*tmxTileset `xml:"tileset"`
+	Layers     []*tmxLayer   `xml:",any"`
+}
+
+type tmxProperties struct {
+	Property []struct {
+		Name  string `xml:"name,attr"`
+		Value string `xml:"value,attr"`
+		Text  string `xml:",chardata"`
+	} `xml:"property"`
+}
+
+func (ps tmxProperties) convert() map[string]string {
+	m := make(map[string]string, len(ps.Property))
+	for _, p := range ps.Property {
+		v := p.Value
+		if v == "" {
+			v = p.Text // multi-line string properties
+		}
+		m[p.Name] = v
+	}
+	return m
+}
+
+type tmxLayer struct {
+	XMLName    xml.Name
+	Name       string        `xml:"name,attr"`
+	Visible    string        `xml:"visible,attr"`
+	OffsetX    float64       `xml:"offsetx,attr"`
+	OffsetY    float64       `xml:"offsety,attr"`
+	Width      int           `xml:"width,attr"`
+	Properties tmxProperties `xml:"properties"`
+	Data       struct {
+		Encoding    string `xml:"encoding,attr"`
+		Compression string `xml:"compression,attr"`
+		Text        string `xml:",chardata"`
+		Tiles       []struct {
+			GID uint32 `xml:"gid,attr"`
+		} `xml:"tile"`
+	} `xml:"data"`
+	Objects []struct {
+		Name       string        `xml:"name,attr"`
+		X          float64       `xml:"x,attr"`
+		Y          float64       `xml:"y,attr"`
+		Width      float64       `xml:"width,attr"`
+		Height     float64       `xml:"height,attr"`
+		GID        uint32        `xml:"gid,attr"`
+		Point      *struct{}     `xml:"point"`
+		Ellipse    *struct{}     `xml:"ellipse"`
+		Polygon    *struct{}     `xml:"polygon"`
+		Polyline   *struct{}     `xml:"polyline"`
+		Text       *struct{}     `xml:"text"`
+		Properties tmxProperties `xml:"properties"`
+	} `xml:"object"`
+	Layers []*tmxLayer `xml:",any"`
+}
+
+type tmxTileset struct {
+	FirstGID   int    `xml:"firstgid,attr"`
+	Source     string `xml:"source,attr"`
+	TileWidth  int    `xml:"tilewidth,attr"`
+	TileHeight int    `xml:"tileheight,attr"`
+	Margin     int    `xml:"margin,attr"`
+	Spacing    int    `xml:"spacing,attr"`
+	Image      struct {
+		Source string `xml:"source,attr"`
+	} `xml:"image"`
+	Tiles []struct {
+		ID     int `xml:"id,attr"`
+		Frames []struct {
+			TileID   int `xml:"tileid,attr"`
+			Duration int `xml:"duration,attr"`
+		} `xml:"animation>frame"`
+	} `xml:"tile"`
+}
+
+func parseTMX(data []byte) (*tiledMap, error) {
+	var raw tmxMap
+	if err := xml.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	m := &tiledMap{
+		width:      raw.Width,
+		height:     raw.Height,
+		tileWidth:  raw.TileWidth,
+		tileHeight: raw.TileHeight,
+		infinite:   raw.Infinite != 0,
+		props:      raw.Properties.convert(),
+	}
+	for _, ts := range raw.Tilesets {
+		m.tilesets = append(m.tilesets, ts.convert())
+	}
+	var err error
+	m.layers, err = tmxLayers(raw.Layers)
+	return m, err
+}
+
+func tmxLayers(raws []*tmxLayer) ([]*tiledLayer, error) {
+	var out []*tiledLayer
+	for _, r := range raws {
+		var kind string
+		switch r.XMLName.Local {
+		case "layer":
+			kind = "tilelayer"
+		case "objectgroup", "group":
+			kind = r.XMLName.Local
+		default:
+			continue // image layers, editor settings, etc
+		}
+		l := &tiledLayer{
+			kind:    kind,
+			name:    r.Name,
+			visible: r.Visible != "0",
+			offsetX: r.OffsetX,
+			offsetY: r.OffsetY,
+			width:   r.Width,
+			props:   r.Properties.convert(),
+		}
+		if kind == "tilelayer" {
+			if r.Data.Encoding == "" {
+				// Deprecated XML format: one <tile> per cell.
+				for _, t := range r.Data.Tiles {
+					l.data = append(l.data, t.GID)
+				}
+			} else {
+				var err error
+				l.data, err = decodeTiledData(r.Data.Encoding, r.Data.Compression, r.Data.Text)
+				if err != nil {
+					return nil, fmt.Errorf("layer %q: %w", r.Name, err)
+				}
+			}
+		}
+		for _, o := range r.Objects {
+			l.objects = append(l.objects, tiledObject{
+				name:   o.Name,
+				x:      o.X,
+				y:      o.Y,
+				width:  o.Width,
+				height: o.Height,
+				rect:   o.GID == 0 && o.Point == nil && o.Ellipse == nil && o.Polygon == nil && o.Polyline == nil && o.Text == nil,
+				props:  o.Properties.convert(),
+			})
+		}
+		var err error
+		if l.layers, err = tmxLayers(r.Layers); err != nil {
+			return nil, err
+		}
+		out = append(out, l)
+	}
+	return out, nil
+}
+
+func (r *tmxTileset) convert() *tiledTileset {
+	ts := &tiledTileset{
+		firstGID:   r.FirstGID,
+		source:     r.Source,
+		image:      r.Image.Source,
+		tileWidth:  r.TileWidth,
+		tileHeight: r.TileHeight,
+		margin:     r.Margin,
+		spacing:    r.Spacing,
+		anims:      make(map[int][]tiledFrame),
+	}
+	for _, t := range r.Tiles {
+		for _, f := range t.Frames {
+			ts.anims[t.ID] = append(ts.anims[t.ID], tiledFrame{tileID: f.TileID, duration: f.Duration})
+		}
+	}
+	return ts
+}
@@ -0,0 +1,279 @@
+/*
+Copyright 2021 Josh Deprez
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/binary"
+	"image"
+	"math"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/DrJosh9000/ichigo/geom"
+	"github.com/google/go-cmp/cmp"
+)
+
+const testTMJ = `{
+	"width": 2, "height": 2, "tilewidth": 8, "tileheight": 8,
+	"properties": [{"name": "id", "type": "string", "value": "level"}],
+	"tilesets": [{
+		"firstgid": 1, "image": "tiles.png", "tilewidth": 8, "tileheight": 8,
+		"tiles": [{"id": 1, "animation": [
+			{"tileid": 1, "duration": 100},
+			{"tileid": 2, "duration": 1}
+		]}]
+	}],
+	"layers": [
+		{"type": "tilelayer", "name": "ground", "visible": true, "width": 2,
+			"data": [1, 2, 0, 1]},
+		{"type": "group", "name": "g", "visible": false, "offsetx": 4, "offsety": 4, "layers": [
+			{"type": "tilelayer", "name": "walls", "visible": true, "width": 2,
+				"properties": [{"name": "wall", "type": "bool", "value": true}],
+				"data": [0, 0, 3, 0]}
+		]},
+		{"type": "objectgroup", "name": "solids", "visible": true, "objects": [
+			{"name": "floor", "x": 0, "y": 12, "width": 16, "height": 4,
+				"properties": [{"name": "minz", "type": "int", "value": -1}]},
+			{"name": "spawn", "x": 2, "y": 2, "point": true}
+		]}
+	]
+}`
+
+func TestImportTiledJSON(t *testing.T) {
+	assets := fstest.MapFS{
+		"maps/level.tmj": {Data: []byte(testTMJ)},
+	}
+	sc, err := ImportTiled(assets, "maps/level.tmj")
+	if err != nil {
+		t.Fatalf("ImportTiled() error = %v", err)
+	}
+	if got, want := sc.ID, ID("level"); got != want {
+		t.Errorf("sc.ID = %q, want %q", got, want)
+	}
+	if got, want := image.Rectangle(sc.Bounds), image.Rect(0, 0, 16, 16); got != want {
+		t.Errorf("sc.Bounds = %v, want %v", got, want)
+	}
+	items := sc.Child.(*Container).items
+	if len(items) != 3 {
+		t.Fatalf("len(items) = %d, want 3", len(items))
+	}
+
+	tm, ok := items[0].(*Tilemap)
+	if !ok {
+		t.Fatalf("items[0] = %T, want *Tilemap", items[0])
+	}
+	if tm.ID != "ground" || tm.Hidden() {
+		t.Errorf("tilemap ID, Hidden = %q, %t, want ground, false", tm.ID, tm.Hidden())
+	}
+	if got, want := tm.Sheet.Src.Path, "maps/tiles.png"; got != want {
+		t.Errorf("tm.Sheet.Src.Path = %q, want %q", got, want)
+	}
+	if got, want := tm.Map[image.Pt(0, 0)], StaticTile(0); got != want {
+		t.Errorf("tm.Map[0,0] = %v, want %v", got, want)
+	}
+	if got, want := tm.Map[image.Pt(1, 1)], StaticTile(0); got != want {
+		t.Errorf("tm.Map[1,1] = %v, want %v", got, want)
+	}
+	if _, ok := tm.Map[image.Pt(0, 1)]; ok {
+		t.Error("tm.Map[0,1] is present, want absent")
+	}
+	at, ok := tm.Map[image.Pt(1, 0)].(*AnimatedTile)
+	if !ok {
+		t.Fatalf("tm.Map[1,0] = %T, want *AnimatedTile", tm.Map[image.Pt(1, 0)])
+	}
+	def := tm.Sheet.AnimDefs[at.AnimKey]
+	if def == nil {
+		t.Fatalf("tm.Sheet.AnimDefs[%q] = nil", at.AnimKey)
+	}
+	wantSteps := []AnimStep{
+		{Cell: 1, Time: 100 * time.Millisecond},
+		{Cell: 2, Time: time.Millisecond},
+	}
+	if diff := cmp.Diff(def.Steps, wantSteps); diff != "" {
+		t.Errorf("anim steps diff (-got +want):\n%s", diff)
+	}
+
+	w, ok := items[1].(*Wall)
+	if !ok {
+		t.Fatalf("items[1] = %T, want *Wall", items[1])
+	}
+	if got, want := w.Offset, image.Pt(4, 4); got != want {
+		t.Errorf("w.Offset = %v, want %v", got, want)
+	}
+	u := w.Units[image.Pt(0, 1)]
+	if u == nil {
+		t.Fatal("w.Units[0,1] = nil")
+	}
+	if got, want := u.Tile, StaticTile(2); got != want {
+		t.Errorf("u.Tile = %v, want %v", got, want)
+	}
+	if !u.Hidden() {
+		t.Error("u.Hidden() = false, want true (group is invisible)")
+	}
+
+	solids := items[2].(*Scene).Child.(*Container).items
+	if len(solids) != 1 {
+		t.Fatalf("len(solids) = %d, want 1", len(solids))
+	}
+	want := geom.Box{
+		Min: geom.Pt3(0, 12, -1),
+		Max: geom.Pt3(16, 16, math.MaxInt32),
+	}
+	if got := solids[0].(*SolidRect).Box; got != want {
+		t.Errorf("solid box = %v, want %v", got, want)
+	}
+}
+
+const testTMX = `<?xml version="1.0" encoding="UTF-8"?>
+<map version="1.8" orientation="orthogonal" width="2" height="1" tilewidth="8" tileheight="8" infinite="0">
+ <tileset firstgid="1" source="../tiles/set.tsx"/>
+ <layer id="1" name="walls" width="2" height="1">
+  <properties>
+   <property name="wall" type="bool" value="true"/>
+  </properties>
+  <data encoding="csv">
+0,2
+</data>
+ </layer>
+</map>`
+
+const testTSX = `<?xml version="1.0" encoding="UTF-8"?>
+<tileset version="1.8" name="set" tilewidth="8" tileheight="16" tilecount="4" columns="2">
+ <image source="set.png" width="16" height="32"/>
+ <tile id="1">
+  <animation>
+   <frame tileid="1" duration="500"/>
+   <frame tileid="3" duration="500"/>
+  </animation>
+ </tile>
+</tileset>`
+
+func TestImportTiledErrors(t *testing.T) {
+	tests := []struct {
+		name, old, new, want string
+	}{
+		{
+			name: "flipped tile",
+			old:  `"data": [1, 2, 0, 1]`,
+			new:  `"data": [1, 2, 0, 2147483649]`,
+			want: `layer "ground": tile at (1,1) is flipped or rotated, which is not supported`,
+		},
+		{
+			name: "duplicate object name",
+			old:  `"name": "spawn", "x": 2, "y": 2, "point": true`,
+			new:  `"name": "floor", "x": 2, "y": 2, "width": 1, "height": 1`,
+			want: `layer "solids": duplicate object name "floor"`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tmj := strings.Replace(testTMJ, test.old, test.new, 1)
+			if tmj == testTMJ {
+				t.Fatalf("test map unchanged; %q not found", test.old)
+			}
+			assets := fstest.MapFS{
+				"maps/level.tmj": {Data: []byte(tmj)},
+			}
+			_, err := ImportTiled(assets, "maps/level.tmj")
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("ImportTiled() error = %v, want error containing %q", err, test.want)
+			}
+		})
+	}
+}
+
+func TestImportTiledXML(t *testing.T) {
+	assets := fstest.MapFS{
+		"maps/level.tmx": {Data: []byte(testTMX)},
+		"tiles/set.tsx":  {Data: []byte(testTSX)},
+	}
+	sc, err := ImportTiled(assets, "maps/level.tmx")
+	if err != nil {
+		t.Fatalf("ImportTiled() error = %v", err)
+	}
+	items := sc.Child.(*Container).items
+	if len(items) != 1 {
+		t.Fatalf("len(items) = %d, want 1", len(items))
+	}
+	w := items[0].(*Wall)
+	if got, want := w.Sheet.Src.Path, "tiles/set.png"; got != want {
+		t.Errorf("w.Sheet.Src.Path = %q, want %q", got, want)
+	}
+	if got, want := w.UnitOffset, image.Pt(0, -8); got != want {
+		t.Errorf("w.UnitOffset = %v, want %v", got, want)
+	}
+	at, ok := w.Units[image.Pt(1, 0)].Tile.(*AnimatedTile)
+	if !ok {
+		t.Fatalf("w.Units[1,0].Tile = %T, want *AnimatedTile", w.Units[image.Pt(1, 0)].Tile)
+	}
+	if got, want := len(w.Sheet.AnimDefs[at.AnimKey].Steps), 2; got != want {
+		t.Errorf("len(steps) = %d, want %d", got, want)
+	}
+}
+
+func TestImportTiledTileSizeMismatch(t *testing.T) {
+	tmx := bytes.Replace([]byte(testTMX), []byte(`value="true"`), []byte(`value="false"`), 1)
+	assets := fstest.MapFS{
+		"maps/level.tmx": {Data: tmx},
+		"tiles/set.tsx":  {Data: []byte(testTSX)},
+	}
+	if _, err := ImportTiled(assets, "maps/level.tmx"); err == nil {
+		t.Error("ImportTiled() error = nil, want error for mismatched tile size")
+	}
+}
+
+func TestDecodeTiledDataBase64Zlib(t *testing.T) {
+	want := []uint32{1, 0, 7, 0x80000003}
+	var raw, buf bytes.Buffer
+	binary.Write(&raw, binary.LittleEndian, want)
+	zw := zlib.NewWriter(&buf)
+	zw.Write(raw.Bytes())
+	zw.Close()
+
+	got, err := decodeTiledData("base64", "zlib", "\n  "+base64.StdEncoding.EncodeToString(buf.Bytes())+"\n")
+	if err != nil {
+		t.Fatalf("decodeTiledData() error = %v", err)
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("decodeTiledData() diff (-got +want):\n%s", diff)
+	}
+}
+
+func TestTiledRefLoad(t *testing.T) {
+	assets := fstest.MapFS{
+		"level.tmj": {Data: []byte(testTMJ)},
+	}
+	r := &TiledRef{Path: "level.tmj"}
+	if err := r.Scan(func(any) error { return nil }); err != nil {
+		t.Errorf("Scan() before Load = %v", err)
+	}
+	if err := r.Load(assets); err != nil {
+		t.Fatalf("Load() = %v", err)
+	}
+	if r.Scene == nil || r.Ident() != "level" {
+		t.Errorf("after Load, Scene = %v", r.Scene)
+	}
+	b, err := r.MarshalText()
+	if err != nil || string(b) != "level.tmj" {
+		t.Errorf("MarshalText() = %q, %v, want level.tmj, nil", b, err)
+	}
+}
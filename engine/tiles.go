@@ -17,10 +17,12 @@ limitations under the License.
 package engine
 
 import (
-	"encoding/gob"
+	"context"
 	"fmt"
 	"image"
 	"io/fs"
+	"sort"
+	"strings"
 
 	"github.com/DrJosh9000/ichigo/geom"
 	"github.com/hajimehoshi/ebiten/v2"
@@ -30,10 +32,13 @@ import (
 var _ interface {
 	Identifier
 	Collider
+	ContextLoader
 	Drawer
 	Hider
+	Loader
 	Scanner
 	Transformer
+	Validator
 } = &Tilemap{}
 
 // Ensure StaticTile and AnimatedTile satisfy Tile.
@@ -46,9 +51,9 @@ var (
 )
 
 func init() {
-	gob.Register(&AnimatedTile{})
-	gob.Register(StaticTile(0))
-	gob.Register(&Tilemap{})
+	RegisterType(&AnimatedTile{})
+	RegisterType(StaticTile(0))
+	RegisterType(&Tilemap{})
 }
 
 // Tilemap renders a grid of rectangular tiles at equal Z position.
@@ -95,13 +100,22 @@ func (t *Tilemap) Draw(screen *ebiten.Image, opts *ebiten.DrawImageOptions) {
 		mat.Concat(og)
 		opts.GeoM = mat
 
-		src := t.Sheet.SubImage(tile.Cell())
-		screen.DrawImage(src, opts)
+		t.Sheet.DrawCell(screen, tile.Cell(), opts)
 	}
 }
 
-// Load instantiates animations for all AnimatedTiles.
-func (t *Tilemap) Load(fs.FS) error {
+// Load loads the tilemap without a cache (see LoadContext).
+func (t *Tilemap) Load(assets fs.FS) error {
+	return t.LoadContext(context.Background(), assets)
+}
+
+// LoadContext instantiates animations for all AnimatedTiles. Components are
+// loaded before their subcomponents, so it loads t.Sheet first, in order for
+// AnimDefs from t.Sheet.Aseprite to be available.
+func (t *Tilemap) LoadContext(ctx context.Context, assets fs.FS) error {
+	if err := t.Sheet.LoadContext(ctx, assets); err != nil {
+		return err
+	}
 	for _, tile := range t.Map {
 		at, ok := tile.(*AnimatedTile)
 		if !ok {
@@ -134,6 +148,27 @@ func (t *Tilemap) Transform() (opts ebiten.DrawImageOptions) {
 	return opts
 }
 
+// Validate checks that every AnimatedTile refers to an AnimDef in the sheet.
+func (t *Tilemap) Validate(*Game, fs.FS) error {
+	var missing []string
+	seen := make(map[string]bool)
+	for _, tile := range t.Map {
+		at, ok := tile.(*AnimatedTile)
+		if !ok || seen[at.AnimKey] {
+			continue
+		}
+		seen[at.AnimKey] = true
+		if t.Sheet.AnimDefs[at.AnimKey] == nil {
+			missing = append(missing, fmt.Sprintf("%q", at.AnimKey))
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("missing anims %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
 // TileAt returns the tile present at the given world coordinate.
 func (t *Tilemap) TileAt(wc image.Point) Tile {
 	return t.Map[geom.CDiv(wc.Sub(t.Offset), t.Sheet.CellSize)]
@@ -0,0 +1,170 @@
+/*
+Copyright 2022 Josh Deprez
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import "sync/atomic"
+
+// Timer is a handle to a function scheduled with Game.After or Game.Every.
+type Timer struct {
+	owner     any
+	period    int // 0 for one-shot timers
+	remaining int // steps until fn is called
+	fn        func()
+	cancelled int32 // accessed atomically; 1 if cancelled or finished
+}
+
+// Cancel stops the timer from firing (again). Cancel is safe to call more than
+// once, and on a nil *Timer.
+func (t *Timer) Cancel() {
+	if t == nil {
+		return
+	}
+	atomic.StoreInt32(&t.cancelled, 1)
+}
+
+// Active reports whether the timer is still waiting to fire.
+func (t *Timer) Active() bool {
+	return t != nil && atomic.LoadInt32(&t.cancelled) == 0
+}
+
+// After schedules fn to be called once, after the given number of simulation
+// steps. The timer belongs to owner: it only counts down on steps where owner
+// would be updated (i.e. not while owner or an ancestor is disabled, and
+// according to any TimeScalers above owner), and it is cancelled when owner
+// is unregistered. owner must be registered already, otherwise the timer is
+// cancelled straight away. owner can be the game itself, for timers that
+// should always run. Timers fire after all the phases of a step have run, so
+// fn may make structural changes to the game tree.
+func (g *Game) After(owner any, ticks int, fn func()) *Timer {
+	return g.schedule(&Timer{owner: owner, remaining: ticks, fn: fn})
+}
+
+// Every schedules fn to be called repeatedly, every given number of simulation
+// steps, until the timer is cancelled. See After for how owner is used.
+func (g *Game) Every(owner any, ticks int, fn func()) *Timer {
+	if ticks < 1 {
+		ticks = 1
+	}
+	return g.schedule(&Timer{owner: owner, period: ticks, remaining: ticks, fn: fn})
+}
+
+func (g *Game) schedule(t *Timer) *Timer {
+	if !g.registered(t.owner) {
+		// It would never be cancelled by unregistering owner.
+		t.Cancel()
+		return t
+	}
+	g.timermu.Lock()
+	defer g.timermu.Unlock()
+	if g.timersByOwner == nil {
+		g.timersByOwner = make(map[any][]*Timer)
+	}
+	g.timers = append(g.timers, t)
+	g.timersByOwner[t.owner] = append(g.timersByOwner[t.owner], t)
+	return t
+}
+
+// cancelTimers cancels all timers belonging to owner.
+func (g *Game) cancelTimers(owner any) {
+	g.timermu.Lock()
+	defer g.timermu.Unlock()
+	for _, t := range g.timersByOwner[owner] {
+		t.Cancel()
+	}
+	delete(g.timersByOwner, owner)
+}
+
+// runTimers counts down and fires timers for the given step of the current
+// tick.
+func (g *Game) runTimers(step int) {
+	g.timermu.Lock()
+	timers := g.timers
+	g.timermu.Unlock()
+
+	for _, t := range timers {
+		if !t.Active() || !g.timerActive(t.owner, step) {
+			continue
+		}
+		if t.remaining--; t.remaining > 0 {
+			continue
+		}
+		if t.period > 0 {
+			t.remaining = t.period
+		} else {
+			t.Cancel()
+		}
+		t.fn()
+	}
+
+	// Discard timers that are finished or cancelled. Timers scheduled by the
+	// timer functions are after len(timers) and weren't examined above.
+	g.timermu.Lock()
+	defer g.timermu.Unlock()
+	live := g.timers[:0]
+	for _, t := range g.timers {
+		if t.Active() {
+			live = append(live, t)
+			continue
+		}
+		owned := g.timersByOwner[t.owner]
+		for i, u := range owned {
+			if u == t {
+				owned = append(owned[:i], owned[i+1:]...)
+				break
+			}
+		}
+		if len(owned) == 0 {
+			delete(g.timersByOwner, t.owner)
+		} else {
+			g.timersByOwner[t.owner] = owned
+		}
+	}
+	for i := len(live); i < len(g.timers); i++ {
+		g.timers[i] = nil
+	}
+	g.timers = live
+}
+
+// timerActive reports if timers belonging to owner should count down in this
+// step: owner must be registered, owner and its ancestors must not be
+// disabled, and its time domain must be running this step.
+func (g *Game) timerActive(owner any, step int) bool {
+	if !g.registered(owner) {
+		return false
+	}
+	var domain any
+	for _, c := range g.ReversePath(owner) {
+		if d, ok := c.(Disabler); ok && d.Disabled() && c != g {
+			return false
+		}
+		if _, ok := c.(TimeScaler); ok && domain == nil {
+			domain = c
+		}
+	}
+	if domain == nil {
+		domain = g
+	}
+	return step < g.clockSteps[domain]
+}
+
+// registered reports whether c is registered.
+func (g *Game) registered(c any) bool {
+	g.dbmu.RLock()
+	defer g.dbmu.RUnlock()
+	_, ok := g.parent[c]
+	return ok
+}
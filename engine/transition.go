@@ -0,0 +1,240 @@
+/*
+Copyright 2021 Josh Deprez
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"sync"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// Ensure transitions satisfy Transition.
+var (
+	_ Transition = &Fade{}
+	_ Transition = &Wipe{}
+	_ Transition = &Iris{}
+)
+
+func init() {
+	RegisterType(&Fade{})
+	RegisterType(&Wipe{})
+	RegisterType(&Iris{})
+}
+
+// Transition draws an animated cover over the screen, for changing scenes
+// (see SceneManager).
+type Transition interface {
+	// Ticks returns the length of each half of the transition (covering the
+	// screen, then uncovering it).
+	Ticks() int
+
+	// Cover draws the cover over the screen. amount ranges from 0 (nothing
+	// covered) to 1 (completely covered).
+	Cover(screen *ebiten.Image, amount float64)
+}
+
+// transitionTicks returns t.Ticks(), or 0 for a nil transition.
+func transitionTicks(t Transition) int {
+	if t == nil {
+		return 0
+	}
+	return t.Ticks()
+}
+
+// Fade fades the screen to a colour.
+type Fade struct {
+	Colour   color.Color // default is black
+	Duration int         // ticks for each half
+}
+
+// Ticks returns f.Duration.
+func (f *Fade) Ticks() int { return f.Duration }
+
+// Cover fills the screen with the colour, with an alpha of amount.
+func (f *Fade) Cover(screen *ebiten.Image, amount float64) {
+	fillRect(screen, screen.Bounds(), coverColour(f.Colour), amount)
+}
+
+// WipeDirection is the direction a Wipe moves while covering the screen.
+type WipeDirection int
+
+// Directions for Wipe.
+const (
+	WipeRight WipeDirection = iota // from the left edge towards the right
+	WipeLeft
+	WipeDown
+	WipeUp
+)
+
+// Wipe covers the screen with a colour by sliding it in from one edge.
+type Wipe struct {
+	Colour    color.Color // default is black
+	Duration  int         // ticks for each half
+	Direction WipeDirection
+}
+
+// Ticks returns w.Duration.
+func (w *Wipe) Ticks() int { return w.Duration }
+
+// Cover fills the covered part of the screen with the colour.
+func (w *Wipe) Cover(screen *ebiten.Image, amount float64) {
+	fillRect(screen, wipeRect(screen.Bounds(), w.Direction, amount), coverColour(w.Colour), 1)
+}
+
+// wipeRect returns the part of bounds covered by a wipe.
+func wipeRect(bounds image.Rectangle, dir WipeDirection, amount float64) image.Rectangle {
+	size := bounds.Size()
+	w := int(math.Round(amount * float64(size.X)))
+	h := int(math.Round(amount * float64(size.Y)))
+	r := bounds
+	switch dir {
+	case WipeRight:
+		r.Max.X = r.Min.X + w
+	case WipeLeft:
+		r.Min.X = r.Max.X - w
+	case WipeDown:
+		r.Max.Y = r.Min.Y + h
+	case WipeUp:
+		r.Min.Y = r.Max.Y - h
+	}
+	return r
+}
+
+// Iris covers the screen with a colour, except for a shrinking circle.
+type Iris struct {
+	Colour   color.Color // default is black
+	Duration int         // ticks for each half
+	Focus    image.Point // centre of the circle; the zero value means the centre of the screen
+
+	buf *ebiten.Image
+}
+
+// Ticks returns i.Duration.
+func (i *Iris) Ticks() int { return i.Duration }
+
+// Cover draws the colour over the screen, except within the circle.
+func (i *Iris) Cover(screen *ebiten.Image, amount float64) {
+	bounds := screen.Bounds()
+	c := coverColour(i.Colour)
+	focus := i.Focus
+	if focus == (image.Point{}) {
+		focus = bounds.Min.Add(bounds.Size().Div(2))
+	}
+	r := irisRadius(bounds, focus, amount)
+	if r <= 0 {
+		fillRect(screen, bounds, c, 1)
+		return
+	}
+	if i.buf == nil || i.buf.Bounds().Size() != bounds.Size() {
+		i.buf = ebiten.NewImage(bounds.Dx(), bounds.Dy())
+	}
+	i.buf.Fill(c)
+
+	// Punch a hole in the cover.
+	disc := irisDisc()
+	var opts ebiten.DrawImageOptions
+	s := 2 * r / irisDiscSize
+	opts.GeoM.Scale(s, s)
+	opts.GeoM.Translate(float64(focus.X-bounds.Min.X)-r, float64(focus.Y-bounds.Min.Y)-r)
+	opts.CompositeMode = ebiten.CompositeModeDestinationOut
+	opts.Filter = ebiten.FilterLinear
+	i.buf.DrawImage(disc, &opts)
+
+	var bopts ebiten.DrawImageOptions
+	bopts.GeoM.Translate(float64(bounds.Min.X), float64(bounds.Min.Y))
+	screen.DrawImage(i.buf, &bopts)
+}
+
+// irisRadius returns the radius of the uncovered circle: large enough to
+// uncover all of bounds when amount is 0, and 0 when amount is 1.
+func irisRadius(bounds image.Rectangle, focus image.Point, amount float64) float64 {
+	max := 0.0
+	for _, p := range []image.Point{
+		bounds.Min,
+		{bounds.Max.X, bounds.Min.Y},
+		{bounds.Min.X, bounds.Max.Y},
+		bounds.Max,
+	} {
+		d := p.Sub(focus)
+		max = math.Max(max, math.Hypot(float64(d.X), float64(d.Y)))
+	}
+	return (1 - amount) * max
+}
+
+// coverColour returns c, or black if c is nil.
+func coverColour(c color.Color) color.Color {
+	if c == nil {
+		return color.Black
+	}
+	return c
+}
+
+const irisDiscSize = 256
+
+var (
+	transitionImagesOnce sync.Once
+	whitePixel           *ebiten.Image
+	irisDiscImage        *ebiten.Image
+)
+
+func makeTransitionImages() {
+	whitePixel = ebiten.NewImage(1, 1)
+	whitePixel.Fill(color.White)
+
+	// Antialiased white disc.
+	img := image.NewAlpha(image.Rect(0, 0, irisDiscSize, irisDiscSize))
+	const r = irisDiscSize / 2
+	for y := 0; y < irisDiscSize; y++ {
+		for x := 0; x < irisDiscSize; x++ {
+			d := math.Hypot(float64(x)+0.5-r, float64(y)+0.5-r)
+			a := math.Max(0, math.Min(1, r-d))
+			img.SetAlpha(x, y, color.Alpha{uint8(a * 255)})
+		}
+	}
+	irisDiscImage = ebiten.NewImageFromImage(img)
+}
+
+func irisDisc() *ebiten.Image {
+	transitionImagesOnce.Do(makeTransitionImages)
+	return irisDiscImage
+}
+
+// fillRect fills the rectangle r of dst with colour c, multiplied by alpha.
+func fillRect(dst *ebiten.Image, r image.Rectangle, c color.Color, alpha float64) {
+	if r.Empty() || alpha <= 0 {
+		return
+	}
+	cr, cg, cb, ca := c.RGBA()
+	if ca == 0 {
+		return
+	}
+	transitionImagesOnce.Do(makeTransitionImages)
+	var opts ebiten.DrawImageOptions
+	opts.GeoM.Scale(float64(r.Dx()), float64(r.Dy()))
+	opts.GeoM.Translate(float64(r.Min.X), float64(r.Min.Y))
+	// ColorM works with non-premultiplied colours.
+	opts.ColorM.Scale(
+		float64(cr)/float64(ca),
+		float64(cg)/float64(ca),
+		float64(cb)/float64(ca),
+		float64(ca)/0xffff*alpha,
+	)
+	dst.DrawImage(whitePixel, &opts)
+}
@@ -0,0 +1,145 @@
+/*
+Copyright 2022 Josh Deprez
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"strings"
+)
+
+// ValidationError describes a problem found by Validate in one component.
+type ValidationError struct {
+	Path      string // human-readable path to the component
+	Component any
+	Err       error
+}
+
+func (e *ValidationError) Error() string { return e.Path + ": " + e.Err.Error() }
+
+// Unwrap returns e.Err.
+func (e *ValidationError) Unwrap() error { return e.Err }
+
+// ValidationErrors is a list of all the problems found by Validate.
+type ValidationErrors []*ValidationError
+
+func (e ValidationErrors) Error() string {
+	lines := make([]string, 0, len(e)+1)
+	lines = append(lines, fmt.Sprintf("%d validation problem(s):", len(e)))
+	for _, ve := range e {
+		lines = append(lines, ve.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Validate checks every registered Validator in the game, and returns all the
+// problems found as ValidationErrors (or nil if there are none). assets may be
+// nil, in which case checks that need assets are skipped.
+//
+// If the component database has been built (e.g. by LoadAndPrepare), the
+// Validators are checked against it. Otherwise Validate loads the components
+// (as Load would, reporting failures as problems, in which case Validators are
+// not called) and checks them against a scratch database, so it can be called
+// before LoadAndPrepare (e.g. from a test). Either way g's database is left as
+// it was, and no Registered or Dispose hooks are called.
+func (g *Game) Validate(assets fs.FS) error {
+	g.dbmu.RLock()
+	built := g.parent != nil
+	g.dbmu.RUnlock()
+	db := g
+	var errs ValidationErrors
+	if !built {
+		if err := g.validateLoad(g, assets, nil, &errs); err != nil {
+			return err
+		}
+		if len(errs) > 0 {
+			// Some subtrees might not exist, so building could panic.
+			return errs
+		}
+		// The scratch game's hooks are never run.
+		db = &Game{Root: g.Root}
+		if err := db.build(); err != nil {
+			return err
+		}
+	}
+
+	walkEach(db, db, func(v Validator) {
+		if err := v.Validate(db, assets); err != nil {
+			errs = append(errs, &ValidationError{
+				Path:      db.PathString(v),
+				Component: v,
+				Err:       err,
+			})
+		}
+	})
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// validateLoad is like Load, but records failures in errs instead of stopping
+// at the first one. Subcomponents of components that fail to load are skipped.
+func (g *Game) validateLoad(component any, assets fs.FS, path []string, errs *ValidationErrors) error {
+	path = append(path, describe(component))
+	if isLoader(component) {
+		ctx := WithAssetCache(context.Background(), g.AssetCache())
+		if err := loadComponent(ctx, component, assets); err != nil {
+			*errs = append(*errs, &ValidationError{
+				Path:      strings.Join(path, "/"),
+				Component: component,
+				Err:       err,
+			})
+			return nil
+		}
+	}
+	if sc, ok := component.(Scanner); ok {
+		return sc.Scan(func(x any) error {
+			return g.validateLoad(x, assets, path, errs)
+		})
+	}
+	return nil
+}
+
+// PathString returns a human-readable description of the path to component,
+// for use in messages. Components with IDs are described by their ID, and
+// others are described using their String method (if available).
+func (g *Game) PathString(component any) string {
+	path := g.Path(component)
+	parts := make([]string, 0, len(path))
+	for _, c := range path {
+		parts = append(parts, describe(c))
+	}
+	return strings.Join(parts, "/")
+}
+
+// describe returns a short description of a component.
+func describe(c any) string {
+	switch c := c.(type) {
+	case *Game:
+		return "Game"
+	case Identifier:
+		if id := c.Ident(); id != "" {
+			return fmt.Sprintf("%q", id)
+		}
+	case *Container:
+		// Container's String lists all the items, which is too long.
+		return "Container"
+	}
+	return fmt.Sprint(c)
+}
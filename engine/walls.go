@@ -17,7 +17,10 @@ limitations under the License.
 package engine
 
 import (
+	"context"
+	"fmt"
 	"image"
+	"io/fs"
 
 	"github.com/DrJosh9000/ichigo/geom"
 	"github.com/hajimehoshi/ebiten/v2"
@@ -26,7 +29,9 @@ import (
 var (
 	_ interface {
 		Collider
+		ContextLoader
 		Identifier
+		Loader
 		Scanner
 		Prepper
 		Transformer
@@ -41,6 +46,10 @@ var (
 	} = &WallUnit{}
 )
 
+func init() {
+	RegisterType(&Wall{})
+}
+
 // Wall is a more flexible kind of tilemap. WallUnits can be added at the same
 // level as other components and are responsible for their own drawing, so that
 // Game can do draw ordering, e.g. hide the player character behind a wall.
@@ -76,6 +85,30 @@ func (w *Wall) CollidesWith(b geom.Box) bool {
 	return false
 }
 
+// Load loads the wall without a cache (see LoadContext).
+func (w *Wall) Load(assets fs.FS) error {
+	return w.LoadContext(context.Background(), assets)
+}
+
+// LoadContext instantiates animations for all AnimatedTiles. As with Tilemap,
+// it loads w.Sheet first, since subcomponents are loaded after w.
+func (w *Wall) LoadContext(ctx context.Context, assets fs.FS) error {
+	if err := w.Sheet.LoadContext(ctx, assets); err != nil {
+		return err
+	}
+	for _, u := range w.Units {
+		at, ok := u.Tile.(*AnimatedTile)
+		if !ok {
+			continue
+		}
+		at.anim = w.Sheet.NewAnim(at.AnimKey)
+		if at.anim == nil {
+			return fmt.Errorf("missing anim %q", at.AnimKey)
+		}
+	}
+	return nil
+}
+
 // Scan visits &w.Sheet and all WallUnits.
 func (w *Wall) Scan(visit VisitFunc) error {
 	if err := visit(&w.Sheet); err != nil {
@@ -118,7 +151,7 @@ type WallUnit struct {
 
 // Draw draws this wall unit.
 func (u *WallUnit) Draw(screen *ebiten.Image, opts *ebiten.DrawImageOptions) {
-	screen.DrawImage(u.wall.Sheet.SubImage(u.Tile.Cell()), opts)
+	u.wall.Sheet.DrawCell(screen, u.Tile.Cell(), opts)
 }
 
 // Scan visits u.Tile.
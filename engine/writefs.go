@@ -0,0 +1,142 @@
+/*
+Copyright 2021 Josh Deprez
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"testing/fstest"
+	"time"
+)
+
+// Ensure types satisfy WriteFS.
+var (
+	_ WriteFS = &MemFS{}
+	_ WriteFS = DirFS("")
+	_ WriteFS = &OverlayFS{}
+)
+
+// WriteFS is an fs.FS that can also be written to. Names are the same as for
+// fs.FS (slash-separated, unrooted; see fs.ValidPath), so a file saved with
+// WriteFile can be loaded again from the same FS using the same name.
+type WriteFS interface {
+	fs.FS
+
+	// WriteFile replaces the contents of the named file with data, creating
+	// the file (and any parent directories) if needed.
+	WriteFile(name string, data []byte) error
+}
+
+// MemFS is a WriteFS stored in memory. It is useful for tests, and for
+// saving on platforms without a writable disk (such as JS). The zero MemFS is
+// empty and ready to use. It is safe to use a MemFS from multiple goroutines.
+type MemFS struct {
+	mu    sync.RWMutex
+	files fstest.MapFS
+}
+
+// Open opens the named file.
+func (m *MemFS) Open(name string) (fs.File, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.files.Open(name)
+}
+
+// WriteFile stores a copy of data as the named file.
+func (m *MemFS) WriteFile(name string, data []byte) error {
+	if !fs.ValidPath(name) || name == "." {
+		return &fs.PathError{Op: "write", Path: name, Err: fs.ErrInvalid}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.files == nil {
+		m.files = make(fstest.MapFS)
+	}
+	// Replace rather than modify the MapFile, so that files already open
+	// keep reading the old data.
+	m.files[name] = &fstest.MapFile{
+		Data:    append([]byte(nil), data...),
+		Mode:    0o644,
+		ModTime: time.Now(),
+	}
+	return nil
+}
+
+// DirFS is a WriteFS for the directory tree rooted at the given OS
+// directory. Reading works like os.DirFS. WriteFile writes to a temporary file
+// and then renames it, so readers never see a partially-written file.
+type DirFS string
+
+// Open opens the named file.
+func (d DirFS) Open(name string) (fs.File, error) {
+	return os.DirFS(string(d)).Open(name)
+}
+
+// WriteFile writes data to the named file.
+func (d DirFS) WriteFile(name string, data []byte) error {
+	if !fs.ValidPath(name) || name == "." {
+		return &fs.PathError{Op: "write", Path: name, Err: fs.ErrInvalid}
+	}
+	dst := filepath.Join(string(d), filepath.FromSlash(name))
+	dir := filepath.Dir(dst)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, path.Base(name))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name()) // no-op once renamed
+	defer f.Close()
+	if _, err := f.Write(data); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), dst)
+}
+
+// OverlayFS layers a writable FS over a read-only one. Files are read from
+// Upper if they exist there, otherwise from Lower, and are written to Upper.
+// For example, saved levels can be written to a DirFS or MemFS overlaid on an
+// embed.FS of the built-in assets, and loaded back using the same names.
+// Note that directories are not merged: opening a directory that exists in
+// Upper only lists Upper's entries.
+type OverlayFS struct {
+	Upper WriteFS
+	Lower fs.FS
+}
+
+// Open opens the named file from Upper, or if it does not exist there, from
+// Lower.
+func (o *OverlayFS) Open(name string) (fs.File, error) {
+	f, err := o.Upper.Open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return o.Lower.Open(name)
+	}
+	return f, err
+}
+
+// WriteFile writes the named file to Upper.
+func (o *OverlayFS) WriteFile(name string, data []byte) error {
+	return o.Upper.WriteFile(name, data)
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2021 Josh Deprez
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import (
+	"io/fs"
+	"testing"
+	"testing/fstest"
+)
+
+func TestWriteFSRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		fs   WriteFS
+	}{
+		{name: "MemFS", fs: new(MemFS)},
+		{name: "DirFS", fs: DirFS(t.TempDir())},
+		{name: "OverlayFS", fs: &OverlayFS{Upper: new(MemFS), Lower: fstest.MapFS{}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			src := &Scene{ID: "saved", Child: MakeContainer()}
+			if err := SaveGobz(src, test.fs, "levels/a.gobz"); err != nil {
+				t.Fatalf("SaveGobz() = %v, want nil", err)
+			}
+			dst := new(Scene)
+			if err := LoadGobz(dst, test.fs, "levels/a.gobz"); err != nil {
+				t.Fatalf("LoadGobz() = %v, want nil", err)
+			}
+			if got, want := dst.Ident(), "saved"; got != want {
+				t.Errorf("loaded scene ID = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestWriteFSInvalidPath(t *testing.T) {
+	for _, name := range []string{"/abs", "../up", "."} {
+		if err := new(MemFS).WriteFile(name, nil); err == nil {
+			t.Errorf("MemFS.WriteFile(%q) = nil, want error", name)
+		}
+	}
+}
+
+func TestOverlayFS(t *testing.T) {
+	o := &OverlayFS{
+		Upper: new(MemFS),
+		Lower: fstest.MapFS{
+			"a": {Data: []byte("lower a")},
+			"b": {Data: []byte("lower b")},
+		},
+	}
+	if err := o.WriteFile("a", []byte("upper a")); err != nil {
+		t.Fatalf("WriteFile(a) = %v, want nil", err)
+	}
+	for name, want := range map[string]string{"a": "upper a", "b": "lower b"} {
+		got, err := fs.ReadFile(o, name)
+		if err != nil {
+			t.Errorf("ReadFile(%q) error = %v", name, err)
+			continue
+		}
+		if string(got) != want {
+			t.Errorf("ReadFile(%q) = %q, want %q", name, got, want)
+		}
+	}
+	if _, err := fs.ReadFile(o, "c"); err == nil {
+		t.Error("ReadFile(c) = nil error, want not exist")
+	}
+}
@@ -63,12 +63,22 @@ func main() {
 	ebiten.SetWindowSize(640, 480)
 	ebiten.SetWindowTitle("TODO")
 
+	// Saved files are written to the example directory (or to memory, on JS),
+	// and files there are loaded in preference to the embedded assets.
+	assets := &engine.OverlayFS{
+		Upper: engine.DirFS("example"),
+		Lower: example.Assets,
+	}
+	if runtime.GOOS == "js" {
+		assets.Upper = new(engine.MemFS)
+	}
+
 	// Change to true to rewrite level1.gobz
 	lev1 := any(&engine.SceneRef{Path: "assets/level1.gobz"})
 	if hardcodedLevel1 {
 		lev1 = example.Level1()
 		if rewriteLevel1 && runtime.GOOS != "js" {
-			if err := engine.SaveGobz(lev1, "example/assets/level1.gobz"); err != nil {
+			if err := engine.SaveGobz(lev1, assets, "assets/level1.gobz"); err != nil {
 				log.Fatalf("Couldn't save level1.gobz: %v", err)
 			}
 		}
@@ -106,12 +116,12 @@ func main() {
 			),
 		},
 	}
-	if err := g.LoadAndPrepare(example.Assets); err != nil {
+	if err := g.LoadAndPrepare(assets); err != nil {
 		log.Fatalf("Loading/preparing error: %v", err)
 	}
 
 	if enableREPL && runtime.GOOS != "js" {
-		go g.REPL(os.Stdin, os.Stdout, example.Assets)
+		go g.REPL(os.Stdin, os.Stdout, assets)
 	}
 
 	if err := ebiten.RunGame(g); err != nil {
@@ -17,7 +17,6 @@ limitations under the License.
 package example
 
 import (
-	"encoding/gob"
 	"fmt"
 	"math"
 
@@ -32,13 +31,14 @@ const awakemanProducesBubbles = true
 var _ interface {
 	engine.Identifier
 	engine.Disabler
+	engine.PostPhysicsUpdater
 	engine.Prepper
 	engine.Scanner
 	engine.Updater
 } = &Awakeman{}
 
 func init() {
-	gob.Register(&Awakeman{})
+	engine.RegisterType(&Awakeman{})
 }
 
 // Awakeman is a bit of a god object for now...
@@ -57,7 +57,6 @@ type Awakeman struct {
 	jumpBuffer  int
 	noclip      bool
 	spawnPoint  geom.Int3
-	bubbleTimer int
 
 	anims map[string]*engine.Anim
 }
@@ -65,8 +64,8 @@ type Awakeman struct {
 // Ident returns "awakeman". There should be only one!
 func (aw *Awakeman) Ident() string { return "awakeman" }
 
-// Update updates Awakeman, including capturing input, applying gravity and
-// movement, and repositioning the camera.
+// Update updates Awakeman, including capturing input, and applying gravity and
+// movement.
 func (aw *Awakeman) Update() error {
 	// TODO: better cheat for noclip
 	if inpututil.IsKeyJustPressed(ebiten.KeyN) {
@@ -84,11 +83,11 @@ func (aw *Awakeman) Update() error {
 	if aw.noclip {
 		upd = aw.noclipUpdate
 	}
-	if err := upd(); err != nil {
-		return err
-	}
+	return upd()
+}
 
-	// Update the camera
+// UpdatePostPhysics repositions the camera, after everything has moved.
+func (aw *Awakeman) UpdatePostPhysics() error {
 	// aw.Pos is top-left corner, so add half size to get centre
 	z := 1.0
 	if ebiten.IsKeyPressed(ebiten.KeyShift) {
@@ -126,27 +125,8 @@ func (aw *Awakeman) realUpdate() error {
 		coyoteTime     = 5
 		jumpBufferTime = 5
 		respawnY       = 1000
-		bubblePeriod   = 6
 	)
 
-	if awakemanProducesBubbles {
-		// Add a bubble?
-		aw.bubbleTimer--
-		if aw.bubbleTimer <= 0 {
-			aw.bubbleTimer = bubblePeriod
-			bubble := NewBubble(aw.Sprite.Actor.Pos.Add(geom.Pt3(-3, -20, -1)))
-			if err := aw.game.Load(bubble, Assets); err != nil {
-				return err
-			}
-			// Add bubble to same parent as aw
-			aw.game.PathRegister(bubble, aw.game.Parent(aw))
-			if err := aw.game.Prepare(bubble); err != nil {
-				return err
-			}
-			bubble.Sprite.SetAnim(bubble.Sprite.Sheet.NewAnim("bubble"))
-		}
-	}
-
 	// Fell below some threshold?
 	if aw.Sprite.Actor.Pos.Y > respawnY {
 		aw.Sprite.Actor.Pos = aw.spawnPoint
@@ -262,12 +242,12 @@ func (aw *Awakeman) realUpdate() error {
 // Prepare captures necessary references to other game components.
 func (aw *Awakeman) Prepare(game *engine.Game) error {
 	aw.game = game
-	cam, ok := game.Component(aw.CameraID).(*engine.Camera)
+	cam, ok := game.LookupFrom(aw, aw.CameraID).(*engine.Camera)
 	if !ok {
 		return fmt.Errorf("component %q not *engine.Camera", aw.CameraID)
 	}
 	aw.camera = cam
-	tst, ok := game.Component(aw.ToastID).(*engine.DebugToast)
+	tst, ok := game.LookupFrom(aw, aw.ToastID).(*engine.DebugToast)
 	if !ok {
 		return fmt.Errorf("component %q not *engine.DebugToast", aw.ToastID)
 	}
@@ -275,9 +255,24 @@ func (aw *Awakeman) Prepare(game *engine.Game) error {
 	aw.anims = aw.Sprite.Sheet.NewAnims()
 	aw.spawnPoint = aw.Sprite.Actor.Pos
 
+	if awakemanProducesBubbles {
+		const bubblePeriod = 6
+		game.Every(aw, bubblePeriod, aw.spawnBubble)
+	}
+
 	return nil
 }
 
+// spawnBubble adds a bubble near Awakeman (unless noclip is enabled).
+func (aw *Awakeman) spawnBubble() {
+	if aw.noclip {
+		return
+	}
+	bubble := NewBubble(aw.Sprite.Actor.Pos.Add(geom.Pt3(-3, -20, -1)))
+	// Add bubble to same parent as aw
+	aw.game.Spawn(bubble, aw.game.Parent(aw))
+}
+
 // Scan visits &aw.Sprite.
 func (aw *Awakeman) Scan(visit engine.VisitFunc) error {
 	return visit(&aw.Sprite)
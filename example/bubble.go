@@ -40,7 +40,7 @@ type Bubble struct {
 }
 
 // NewBubble creates a bubble. Before it can be used, the return value needs to
-// be loaded, registered, and prepared.
+// be loaded, registered, and prepared (e.g. with Game.Spawn).
 func NewBubble(pos geom.Int3) *Bubble {
 	return &Bubble{
 		Life: 60,
@@ -84,9 +84,10 @@ func (b *Bubble) String() string {
 	return fmt.Sprintf("Bubble@%v", b.Sprite.Actor.Pos)
 }
 
-// Prepare saves a reference to g.
+// Prepare saves a reference to g and starts the bubble animation.
 func (b *Bubble) Prepare(g *engine.Game) error {
 	b.game = g
+	b.Sprite.SetAnim(b.Sprite.Sheet.NewAnim("bubble"))
 	return nil
 }
 
@@ -95,7 +96,7 @@ func (b *Bubble) Prepare(g *engine.Game) error {
 func (b *Bubble) Update() error {
 	b.Life--
 	if b.Life <= 0 {
-		b.game.PathUnregister(b)
+		b.game.Despawn(b)
 	}
 	die := func() { b.Life = 0 }
 	b.Sprite.Actor.MoveX(float64(rand.Intn(3)-1), die)